@@ -6,21 +6,63 @@ import (
 )
 
 // Config is the bucket configuration.
-// Both the leaky and token bucket algorithms share the same bucket configuration.
+// All the algorithms share the same bucket configuration.
 type Config struct {
 	// Token bucket:
 	//     the interval between each addition of one token
 	// Leaky bucket:
 	//     the interval between each leak of one unit of water
+	// Sliding window log, sliding window counter and fixed window:
+	//     the length of the window
+	// Concurrency limiter:
+	//     the time-to-live of each lease
 	Interval time.Duration
 
-	// the capacity of the bucket
+	// Token bucket and leaky bucket:
+	//     the capacity of the bucket
+	// Sliding window log, sliding window counter and fixed window:
+	//     the maximum number of units allowed in any window
+	// Concurrency limiter:
+	//     the maximum number of leases held at the same time
 	Capacity int64
+
+	// Fixed window:
+	//     the time zone whose midnight the windows are aligned to,
+	//     or nil to align the windows to the Unix epoch
+	// Other algorithms:
+	//     unused
+	Location *time.Location
+}
+
+// baseClock is a basic structure for the types whose clock can be replaced,
+// whose mu also guards the other fields of the embedding type.
+type baseClock struct {
+	mu    sync.RWMutex
+	clock Clock
+}
+
+// Clock returns the clock in a concurrency-safe way, which is the system
+// clock unless replaced by SetClock.
+func (c *baseClock) Clock() Clock {
+	c.mu.RLock()
+	clock := c.clock
+	c.mu.RUnlock()
+	if clock == nil {
+		return systemClock{}
+	}
+	return clock
+}
+
+// SetClock replaces the clock in a concurrency-safe way.
+func (c *baseClock) SetClock(clock Clock) {
+	c.mu.Lock()
+	c.clock = clock
+	c.mu.Unlock()
 }
 
-// baseBucket is a basic structure both for TokenBucket and LeakyBucket.
+// baseBucket is a basic structure for all the algorithms.
 type baseBucket struct {
-	mu     sync.RWMutex
+	baseClock
 	config *Config
 }
 
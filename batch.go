@@ -0,0 +1,327 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// BatchStore is an optional interface that can be implemented by a Store
+// to execute many operations at once, e.g. in one round trip to Redis.
+type BatchStore interface {
+	Store
+
+	// ExecBatch executes ops atomically as a whole, and returns the reply
+	// of each operation in order.
+	ExecBatch(ctx context.Context, ops []BatchOp) ([][]int64, error)
+}
+
+// AllOrNothingStore is an optional interface that can be implemented by
+// a Store to execute many operations of the limits at once, which only
+// take effect if all of them are allowed.
+type AllOrNothingStore interface {
+	Store
+
+	// ExecAllOrNothing executes ops like ExecBatch, but undoes all of their
+	// writes unless every operation is allowed, i.e. each reply starts
+	// with 1. Only the operations storing string values are supported.
+	ExecAllOrNothing(ctx context.Context, ops []BatchOp) ([][]int64, error)
+}
+
+var (
+	_ BatchStore = (*RedisStore)(nil)
+	_ BatchStore = (*Memory)(nil)
+	_ BatchStore = (*CircuitBreaker)(nil)
+
+	_ AllOrNothingStore = (*RedisStore)(nil)
+	_ AllOrNothingStore = (*Memory)(nil)
+	_ AllOrNothingStore = (*CircuitBreaker)(nil)
+)
+
+// BatchOp is an operation of a batch, along with its keys and args.
+type BatchOp struct {
+	Op   *Op
+	Keys []string
+	Args []int64
+}
+
+// Check is a rate-limiting decision of a batch, which asks whether Amount
+// units are allowed to pass Limiter.
+type Check struct {
+	Limiter Limiter
+	Amount  int64
+}
+
+// AllowBatch makes the decisions of checks, and returns the result of each
+// check in order. The checks of the limiters sharing the same BatchStore
+// are made in one round trip, e.g. the per-user, per-org and per-endpoint
+// limits of an API call. Any other check is made by calling Allow of its
+// limiter separately.
+//
+// Note that each check consumes its amount independently of the others,
+// even if some of them are not allowed.
+func AllowBatch(ctx context.Context, checks ...Check) ([]Result, error) {
+	results := make([]Result, len(checks))
+
+	// The calls to make in batch, grouped by store in order of appearance.
+	var groups []callGroup
+	calls := make([]*call, len(checks))
+
+	for i, c := range checks {
+		p, ok := c.Limiter.(preparer)
+		if !ok {
+			r, err := c.Limiter.Allow(ctx, c.Amount)
+			if err != nil {
+				return nil, err
+			}
+			results[i] = r
+			continue
+		}
+
+		calls[i] = p.prepare(c.Amount)
+		if calls[i].op == nil {
+			results[i] = calls[i].result
+			continue
+		}
+		groups = addToGroup(groups, calls[i].store, i)
+	}
+
+	for _, g := range groups {
+		indexes := g.indexes
+
+		bs, ok := g.store.(BatchStore)
+		if !ok || len(indexes) == 1 {
+			for _, i := range indexes {
+				r, err := calls[i].exec(ctx)
+				if err != nil {
+					return nil, err
+				}
+				results[i] = r
+			}
+			continue
+		}
+
+		ops := make([]BatchOp, len(indexes))
+		for j, i := range indexes {
+			ops[j] = calls[i].batchOp()
+		}
+		replies, err := bs.ExecBatch(ctx, ops)
+		if err != nil {
+			return nil, err
+		}
+		for j, i := range indexes {
+			r, err := calls[i].parse(replies[j])
+			if err != nil {
+				return nil, err
+			}
+			results[i] = r
+		}
+	}
+
+	return results, nil
+}
+
+// callGroup is a group of calls, given by their indexes, to make against
+// the same store.
+type callGroup struct {
+	store   Store
+	indexes []int
+}
+
+// addToGroup adds the call of index i against store to its group in groups.
+func addToGroup(groups []callGroup, store Store, i int) []callGroup {
+	for j := range groups {
+		if sameStore(groups[j].store, store) {
+			groups[j].indexes = append(groups[j].indexes, i)
+			return groups
+		}
+	}
+	return append(groups, callGroup{store: store, indexes: []int{i}})
+}
+
+// sameStore reports whether a and b are the same store. The stores whose
+// type is not comparable are never the same, since comparing them panics.
+func sameStore(a, b Store) bool {
+	t := reflect.TypeOf(a)
+	return t != nil && t == reflect.TypeOf(b) && t.Comparable() && a == b
+}
+
+// AllowAll is like AllowBatch, but the checks only consume their amounts
+// if all of them are allowed, e.g. for a request to pass the per-user and
+// per-org limits as a whole. Otherwise, none of them is allowed, and the
+// results of the checks that would have been allowed on their own report
+// the Remaining, ResetAfter and ResetAt as before the request, along with
+// the longest RetryAfter of the checks denied.
+//
+// All the checks must be made by TokenBucket, LeakyBucket or GCRA sharing
+// the same AllOrNothingStore, whose type must be comparable (e.g. a pointer),
+// and are made in one round trip. In Redis
+// Cluster, all the keys must be in the same hash slot, e.g. by sharing
+// a hash tag like "{org:7}:user:42" and "{org:7}".
+func AllowAll(ctx context.Context, checks ...Check) ([]Result, error) {
+	calls := make([]*call, len(checks))
+	// The duration each unit adds to the ResetAfter of each check.
+	intervals := make([]time.Duration, len(checks))
+	for i, c := range checks {
+		switch c.Limiter.(type) {
+		case *TokenBucket, *LeakyBucket, *GCRA:
+			calls[i] = c.Limiter.(preparer).prepare(c.Amount)
+			intervals[i] = c.Limiter.(interface{ Config() Config }).Config().Interval
+		default:
+			return nil, fmt.Errorf("ratelimiter: %T does not support all-or-nothing admission", c.Limiter)
+		}
+	}
+
+	results := make([]Result, len(checks))
+
+	// A check that can never be allowed fails all the checks forever.
+	for _, c := range calls {
+		if c.op == nil && !c.result.Allowed {
+			for i, c := range calls {
+				results[i] = newUnsatisfiableResult(c.limit)
+			}
+			return results, nil
+		}
+	}
+
+	var store AllOrNothingStore
+	ops := make([]BatchOp, len(calls))
+	for i, c := range calls {
+		s, ok := c.store.(AllOrNothingStore)
+		if !ok {
+			return nil, fmt.Errorf("ratelimiter: store %T does not support all-or-nothing admission", c.store)
+		}
+		if store == nil {
+			store = s
+		} else if !sameStore(s, store) {
+			return nil, errors.New("ratelimiter: all-or-nothing admission across stores")
+		}
+		ops[i] = c.batchOp()
+	}
+	if store == nil {
+		return results, nil
+	}
+
+	replies, err := store.ExecAllOrNothing(ctx, ops)
+	if err != nil {
+		return nil, err
+	}
+	for i, c := range calls {
+		if results[i], err = c.parse(replies[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	if !admitted(replies) {
+		retryAfter := deniedRetryAfter(results)
+		for i, r := range results {
+			if r.Allowed {
+				resetAfter := r.ResetAfter - time.Duration(checks[i].Amount)*intervals[i]
+				if resetAfter < 0 {
+					resetAfter = 0
+				}
+				results[i] = Result{
+					Limit:      r.Limit,
+					Remaining:  r.Remaining + checks[i].Amount,
+					RetryAfter: retryAfter,
+					ResetAfter: resetAfter,
+					ResetAt:    calls[i].now.Add(resetAfter),
+				}
+			}
+		}
+	}
+	return results, nil
+}
+
+// deniedRetryAfter returns the longest RetryAfter of the results denied,
+// after which all of them may be allowed, or -1 if any of them can never
+// be allowed.
+func deniedRetryAfter(results []Result) time.Duration {
+	var retryAfter time.Duration
+	for _, r := range results {
+		if r.Allowed {
+			continue
+		}
+		if r.RetryAfter < 0 {
+			return -1
+		}
+		if r.RetryAfter > retryAfter {
+			retryAfter = r.RetryAfter
+		}
+	}
+	return retryAfter
+}
+
+// admitted reports whether all the operations replying with replies
+// are allowed.
+func admitted(replies [][]int64) bool {
+	for _, reply := range replies {
+		if len(reply) == 0 || reply[0] != 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// preparer is implemented by the algorithms in this package, whose
+// decisions can be prepared as calls and then made in batch.
+type preparer interface {
+	prepare(amount int64) *call
+}
+
+var (
+	_ preparer = (*TokenBucket)(nil)
+	_ preparer = (*LeakyBucket)(nil)
+	_ preparer = (*GCRA)(nil)
+	_ preparer = (*SlidingWindowLog)(nil)
+	_ preparer = (*SlidingWindowCounter)(nil)
+	_ preparer = (*FixedWindow)(nil)
+)
+
+// call is a prepared rate-limiting decision made at now, by executing op
+// against store, unless op is nil and the result is known beforehand.
+type call struct {
+	store Store
+	op    *Op
+	keys  []string
+	args  []int64
+	limit int64
+	now   time.Time
+
+	// resetAt overrides the ResetAt of the result unless it is zero.
+	resetAt time.Time
+
+	result Result
+}
+
+// resolvedCall returns a call whose result is known beforehand.
+func resolvedCall(result Result) *call {
+	return &call{result: result}
+}
+
+// exec makes the decision of the call.
+func (c *call) exec(ctx context.Context) (Result, error) {
+	if c.op == nil {
+		return c.result, nil
+	}
+	reply, err := c.store.Exec(ctx, c.op, c.keys, c.args...)
+	if err != nil {
+		return Result{}, err
+	}
+	return c.parse(reply)
+}
+
+// parse converts the reply of the operation into a Result.
+func (c *call) parse(reply []int64) (Result, error) {
+	r, err := parseResult(reply, c.limit, c.now)
+	if err == nil && !c.resetAt.IsZero() {
+		r.ResetAt = c.resetAt
+	}
+	return r, err
+}
+
+func (c *call) batchOp() BatchOp {
+	return BatchOp{Op: c.op, Keys: c.keys, Args: c.args}
+}
@@ -0,0 +1,296 @@
+package ratelimiter_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/RussellLuo/ratelimiter"
+	"github.com/go-redis/redis"
+)
+
+// countingRedis counts the scripts run, i.e. the round trips to Redis.
+type countingRedis struct {
+	Redis
+	runs int32
+}
+
+func (r *countingRedis) EvalShaContext(ctx context.Context, sha1 string, keys []string, args ...interface{}) (interface{}, error, bool) {
+	atomic.AddInt32(&r.runs, 1)
+	return r.Redis.EvalShaContext(ctx, sha1, keys, args...)
+}
+
+func (r *countingRedis) Runs() int {
+	return int(atomic.LoadInt32(&r.runs))
+}
+
+func TestAllowBatch(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	prefix := "ratelimiter:batch:test"
+	counting := &countingRedis{Redis: Redis{client}}
+
+	stores := map[string]ratelimiter.Store{
+		"redis":            ratelimiter.NewRedisStore(counting),
+		"redis-servertime": ratelimiter.NewRedisStore(counting, ratelimiter.WithServerTime()),
+		"memory":           ratelimiter.NewMemory(),
+	}
+	for name, store := range stores {
+		client.Del(prefix+":user", prefix+":org", prefix+":endpoint")
+
+		user := ratelimiter.NewTokenBucketWithStore(store, prefix+":user", &ratelimiter.Config{
+			Interval: time.Second,
+			Capacity: 2,
+		})
+		org := ratelimiter.NewGCRAWithStore(store, prefix+":org", &ratelimiter.Config{
+			Interval: time.Second,
+			Capacity: 10,
+		})
+		endpoint := ratelimiter.NewSlidingWindowLogWithStore(store, prefix+":endpoint", &ratelimiter.Config{
+			Interval: time.Minute,
+			Capacity: 3,
+		})
+		checks := []ratelimiter.Check{
+			{Limiter: user, Amount: 1},
+			{Limiter: org, Amount: 1},
+			{Limiter: endpoint, Amount: 1},
+			// Never allowed, without consulting the store.
+			{Limiter: user, Amount: 3},
+		}
+
+		wants := [][]ratelimiter.Result{
+			{
+				{Allowed: true, Limit: 2, Remaining: 1},
+				{Allowed: true, Limit: 10, Remaining: 9},
+				{Allowed: true, Limit: 3, Remaining: 2},
+				{Allowed: false, Limit: 2, RetryAfter: -1},
+			},
+			{
+				{Allowed: true, Limit: 2, Remaining: 0},
+				{Allowed: true, Limit: 10, Remaining: 8},
+				{Allowed: true, Limit: 3, Remaining: 1},
+				{Allowed: false, Limit: 2, RetryAfter: -1},
+			},
+			// Each check is made independently of the others.
+			{
+				{Allowed: false, Limit: 2, Remaining: 0},
+				{Allowed: true, Limit: 10, Remaining: 7},
+				{Allowed: true, Limit: 3, Remaining: 0},
+				{Allowed: false, Limit: 2, RetryAfter: -1},
+			},
+		}
+		for i, want := range wants {
+			runs := counting.Runs()
+			got, err := ratelimiter.AllowBatch(context.Background(), checks...)
+			if err != nil {
+				t.Fatalf("%s: #%d: Err: %v", name, i, err)
+			}
+			for j := range want {
+				if !(got[j].Allowed == want[j].Allowed && got[j].Limit == want[j].Limit &&
+					got[j].Remaining == want[j].Remaining && (want[j].RetryAfter >= 0 || got[j].RetryAfter < 0)) {
+					t.Errorf("%s: #%d: check %d: Got (%#v) != Want (%#v)", name, i, j, got[j], want[j])
+				}
+			}
+			if name != "memory" {
+				if n := counting.Runs() - runs; n != 1 {
+					t.Errorf("%s: #%d: Got (%d) round trips != Want (1)", name, i, n)
+				}
+			}
+		}
+	}
+}
+
+func TestAllowBatch_Stores(t *testing.T) {
+	memory := ratelimiter.NewMemory()
+	other := newDownStore()
+	config := &ratelimiter.Config{
+		Interval: time.Second,
+		Capacity: 5,
+	}
+
+	leased := ratelimiter.NewLeasedTokenBucket(
+		ratelimiter.NewTokenBucketWithStore(memory, "ratelimiter:batch:leased", config),
+		&ratelimiter.LeaseConfig{Size: 3, TTL: time.Second},
+	)
+	checks := []ratelimiter.Check{
+		{Limiter: ratelimiter.NewFixedWindowWithStore(memory, "ratelimiter:batch:memory", config), Amount: 2},
+		// The store is not a BatchStore.
+		{Limiter: ratelimiter.NewFixedWindowWithStore(other, "ratelimiter:batch:other", config), Amount: 3},
+		// The limiter is not one of the algorithms.
+		{Limiter: leased, Amount: 1},
+	}
+	want := []int64{3, 2, 2}
+
+	got, err := ratelimiter.AllowBatch(context.Background(), checks...)
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	for i := range want {
+		if !got[i].Allowed || got[i].Remaining != want[i] {
+			t.Errorf("#%d: Got (%#v) != Want (Allowed: true, Remaining: %d)", i, got[i], want[i])
+		}
+	}
+
+	other.SetDown(true)
+	if _, err := ratelimiter.AllowBatch(context.Background(), checks...); err != errDown {
+		t.Errorf("Got (%v) != Want (%v)", err, errDown)
+	}
+}
+
+// taggedStore is a Store whose type is not comparable.
+type taggedStore struct {
+	*ratelimiter.Memory
+	tags []string
+}
+
+func TestAllowBatch_NonComparableStore(t *testing.T) {
+	store := taggedStore{Memory: ratelimiter.NewMemory(), tags: []string{"test"}}
+	config := &ratelimiter.Config{
+		Interval: time.Second,
+		Capacity: 5,
+	}
+
+	got, err := ratelimiter.AllowBatch(context.Background(),
+		ratelimiter.Check{Limiter: ratelimiter.NewFixedWindowWithStore(store, "ratelimiter:batch:a", config), Amount: 1},
+		ratelimiter.Check{Limiter: ratelimiter.NewFixedWindowWithStore(store, "ratelimiter:batch:b", config), Amount: 2},
+	)
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	for i, want := range []int64{4, 3} {
+		if !got[i].Allowed || got[i].Remaining != want {
+			t.Errorf("#%d: Got (%#v) != Want (Allowed: true, Remaining: %d)", i, got[i], want)
+		}
+	}
+}
+
+func TestAllowAll(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	prefix := "ratelimiter:allowall:test"
+
+	stores := map[string]ratelimiter.Store{
+		"redis":  ratelimiter.NewRedisStore(&Redis{client}),
+		"memory": ratelimiter.NewMemory(),
+	}
+	for name, store := range stores {
+		client.Del("{"+prefix+"}:user", "{"+prefix+"}:org", "{"+prefix+"}:endpoint")
+
+		clock := ratelimiter.NewFakeClock(time.Now())
+		user := ratelimiter.NewTokenBucketWithStore(store, "{"+prefix+"}:user", &ratelimiter.Config{
+			Interval: time.Second,
+			Capacity: 5,
+		})
+		user.SetClock(clock)
+		org := ratelimiter.NewGCRAWithStore(store, "{"+prefix+"}:org", &ratelimiter.Config{
+			Interval: time.Second,
+			Capacity: 3,
+		})
+		org.SetClock(clock)
+		endpoint := ratelimiter.NewLeakyBucketWithStore(store, "{"+prefix+"}:endpoint", &ratelimiter.Config{
+			Interval: time.Second,
+			Capacity: 10,
+		})
+		endpoint.SetClock(clock)
+
+		cases := []struct {
+			amounts []int64
+			want    []ratelimiter.Result
+		}{
+			{
+				amounts: []int64{2, 2, 1},
+				want: []ratelimiter.Result{
+					{Allowed: true, Remaining: 3, ResetAfter: 2 * time.Second},
+					{Allowed: true, Remaining: 1, ResetAfter: 2 * time.Second},
+					{Allowed: true, Remaining: 9, ResetAfter: 1 * time.Second},
+				},
+			},
+			// The org denies, so nothing is consumed, and all the checks
+			// are to be retried after the org allows.
+			{
+				amounts: []int64{2, 2, 1},
+				want: []ratelimiter.Result{
+					{Allowed: false, Remaining: 3, RetryAfter: 1 * time.Second, ResetAfter: 2 * time.Second},
+					{Allowed: false, Remaining: 1, RetryAfter: 1 * time.Second, ResetAfter: 2 * time.Second},
+					{Allowed: false, Remaining: 9, RetryAfter: 1 * time.Second, ResetAfter: 1 * time.Second},
+				},
+			},
+			{
+				amounts: []int64{3, 1, 1},
+				want: []ratelimiter.Result{
+					{Allowed: true, Remaining: 0, ResetAfter: 5 * time.Second},
+					{Allowed: true, Remaining: 0, ResetAfter: 3 * time.Second},
+					{Allowed: true, Remaining: 8, ResetAfter: 2 * time.Second},
+				},
+			},
+			// The user can never be allowed such an amount.
+			{
+				amounts: []int64{6, 1, 1},
+				want: []ratelimiter.Result{
+					{Allowed: false, RetryAfter: -1},
+					{Allowed: false, RetryAfter: -1},
+					{Allowed: false, RetryAfter: -1},
+				},
+			},
+		}
+		for i, c := range cases {
+			got, err := ratelimiter.AllowAll(context.Background(),
+				ratelimiter.Check{Limiter: user, Amount: c.amounts[0]},
+				ratelimiter.Check{Limiter: org, Amount: c.amounts[1]},
+				ratelimiter.Check{Limiter: endpoint, Amount: c.amounts[2]},
+			)
+			if err != nil {
+				t.Fatalf("%s: #%d: Err: %v", name, i, err)
+			}
+			for j, want := range c.want {
+				if !(got[j].Allowed == want.Allowed && got[j].Remaining == want.Remaining &&
+					got[j].RetryAfter == want.RetryAfter && got[j].ResetAfter == want.ResetAfter &&
+					(want.RetryAfter < 0 || got[j].ResetAt.Equal(clock.Now().Add(want.ResetAfter)))) {
+					t.Errorf("%s: #%d: check %d: Got (%#v) != Want (%#v)", name, i, j, got[j], want)
+				}
+			}
+		}
+	}
+}
+
+func TestAllowAll_Unsupported(t *testing.T) {
+	memory := ratelimiter.NewMemory()
+	config := &ratelimiter.Config{
+		Interval: time.Second,
+		Capacity: 5,
+	}
+
+	cases := []struct {
+		name   string
+		checks []ratelimiter.Check
+	}{
+		{
+			name: "algorithm",
+			checks: []ratelimiter.Check{
+				{Limiter: ratelimiter.NewTokenBucketWithStore(memory, "ratelimiter:allowall:a", config), Amount: 1},
+				{Limiter: ratelimiter.NewSlidingWindowLogWithStore(memory, "ratelimiter:allowall:b", config), Amount: 1},
+			},
+		},
+		{
+			name: "stores",
+			checks: []ratelimiter.Check{
+				{Limiter: ratelimiter.NewTokenBucketWithStore(memory, "ratelimiter:allowall:a", config), Amount: 1},
+				{Limiter: ratelimiter.NewTokenBucketWithStore(ratelimiter.NewMemory(), "ratelimiter:allowall:b", config), Amount: 1},
+			},
+		},
+		{
+			name: "store",
+			checks: []ratelimiter.Check{
+				{Limiter: ratelimiter.NewTokenBucketWithStore(newDownStore(), "ratelimiter:allowall:a", config), Amount: 1},
+			},
+		},
+	}
+	for _, c := range cases {
+		if _, err := ratelimiter.AllowAll(context.Background(), c.checks...); err == nil {
+			t.Errorf("%s: Got no error", c.name)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by CircuitBreaker while the circuit is open.
+var ErrCircuitOpen = errors.New("ratelimiter: circuit open")
+
+// CircuitBreaker is a Store that stops executing the operations against
+// an underlying store, once it fails a number of times in a row, so that
+// a dead backend (e.g. Redis) is not hammered by every request.
+//
+// After threshold consecutive failures, the circuit opens and Exec fails
+// fast with ErrCircuitOpen for the duration of cooldown. Then a single
+// trial operation is let through, which closes the circuit if it succeeds,
+// or opens the circuit again otherwise.
+//
+// An operation exceeding the deadline of its ctx counts as a failure, since
+// a hung backend fails that way. An operation whose ctx is cancelled counts
+// as neither a failure nor a success. The outcomes of the operations that
+// started before the circuit opened are ignored while the circuit is open.
+type CircuitBreaker struct {
+	store     Store
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	clock    Clock
+	failures int
+	openedAt time.Time
+	trying   bool
+}
+
+// NewCircuitBreaker returns a new circuit breaker around store.
+func NewCircuitBreaker(store Store, threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		store:     store,
+		threshold: threshold,
+		cooldown:  cooldown,
+		clock:     systemClock{},
+	}
+}
+
+// SetClock replaces the clock timing the cooldown in a concurrency-safe way.
+func (b *CircuitBreaker) SetClock(clock Clock) {
+	b.mu.Lock()
+	b.clock = clock
+	b.mu.Unlock()
+}
+
+// Exec implements Store by executing op against the underlying store,
+// unless the circuit is open.
+func (b *CircuitBreaker) Exec(ctx context.Context, op *Op, keys []string, args ...int64) ([]int64, error) {
+	trial, ok := b.acquire()
+	if !ok {
+		return nil, ErrCircuitOpen
+	}
+
+	reply, err := b.store.Exec(ctx, op, keys, args...)
+	b.release(ctx, trial, err)
+	return reply, err
+}
+
+// ExecBatch implements BatchStore by executing ops against the underlying
+// store, unless the circuit is open. If the underlying store is not
+// a BatchStore, ops are executed one by one.
+func (b *CircuitBreaker) ExecBatch(ctx context.Context, ops []BatchOp) ([][]int64, error) {
+	trial, ok := b.acquire()
+	if !ok {
+		return nil, ErrCircuitOpen
+	}
+
+	replies, err := b.execBatch(ctx, ops)
+	b.release(ctx, trial, err)
+	return replies, err
+}
+
+// ExecAllOrNothing implements AllOrNothingStore by executing ops against
+// the underlying store, unless the circuit is open. It fails if the
+// underlying store is not an AllOrNothingStore.
+func (b *CircuitBreaker) ExecAllOrNothing(ctx context.Context, ops []BatchOp) ([][]int64, error) {
+	s, ok := b.store.(AllOrNothingStore)
+	if !ok {
+		return nil, fmt.Errorf("ratelimiter: store %T does not support all-or-nothing admission", b.store)
+	}
+	trial, ok := b.acquire()
+	if !ok {
+		return nil, ErrCircuitOpen
+	}
+
+	replies, err := s.ExecAllOrNothing(ctx, ops)
+	b.release(ctx, trial, err)
+	return replies, err
+}
+
+func (b *CircuitBreaker) execBatch(ctx context.Context, ops []BatchOp) ([][]int64, error) {
+	if bs, ok := b.store.(BatchStore); ok {
+		return bs.ExecBatch(ctx, ops)
+	}
+
+	replies := make([][]int64, len(ops))
+	for i, o := range ops {
+		reply, err := b.store.Exec(ctx, o.Op, o.Keys, o.Args...)
+		if err != nil {
+			return nil, err
+		}
+		replies[i] = reply
+	}
+	return replies, nil
+}
+
+// Open reports whether the circuit is open.
+func (b *CircuitBreaker) Open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.openedAt.IsZero()
+}
+
+// acquire reports whether an operation is allowed to be executed,
+// and whether it is the trial operation of an open circuit.
+func (b *CircuitBreaker) acquire() (trial, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.openedAt.IsZero() {
+		return false, true
+	}
+	if b.trying || b.clock.Now().Sub(b.openedAt) < b.cooldown {
+		return false, false
+	}
+	b.trying = true
+	return true, true
+}
+
+// release records the outcome err of an operation executed with ctx,
+// which is the trial operation if trial is true.
+func (b *CircuitBreaker) release(ctx context.Context, trial bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if trial {
+		b.trying = false
+	}
+
+	switch {
+	case err != nil && errors.Is(ctx.Err(), context.Canceled):
+		// The caller gave up, which tells nothing about the store.
+	case !trial && !b.openedAt.IsZero():
+		// The operation started before the circuit opened.
+	case err == nil:
+		b.failures = 0
+		b.openedAt = time.Time{}
+	default:
+		b.failures++
+		if trial || b.failures >= b.threshold {
+			b.openedAt = b.clock.Now()
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package ratelimiter_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/RussellLuo/ratelimiter"
+)
+
+var errDown = errors.New("store is down")
+
+// downStore is a Store that fails while it is down, and otherwise executes
+// the operations against an in-memory store. It counts the executions.
+type downStore struct {
+	store ratelimiter.Store
+	down  int32
+	calls int32
+}
+
+func newDownStore() *downStore {
+	return &downStore{store: ratelimiter.NewMemory()}
+}
+
+func (s *downStore) SetDown(down bool) {
+	var v int32
+	if down {
+		v = 1
+	}
+	atomic.StoreInt32(&s.down, v)
+}
+
+func (s *downStore) Calls() int {
+	return int(atomic.LoadInt32(&s.calls))
+}
+
+func (s *downStore) Exec(ctx context.Context, op *ratelimiter.Op, keys []string, args ...int64) ([]int64, error) {
+	atomic.AddInt32(&s.calls, 1)
+	if atomic.LoadInt32(&s.down) == 1 {
+		return nil, errDown
+	}
+	return s.store.Exec(ctx, op, keys, args...)
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	store := newDownStore()
+	cooldown := 50 * time.Millisecond
+	clock := ratelimiter.NewFakeClock(time.Now())
+	breaker := ratelimiter.NewCircuitBreaker(store, 3, cooldown)
+	breaker.SetClock(clock)
+	limiter := ratelimiter.NewTokenBucketWithStore(breaker, "ratelimiter:circuitbreaker:test", &ratelimiter.Config{
+		Interval: time.Second,
+		Capacity: 10,
+	})
+	ctx := context.Background()
+
+	allow := func() error {
+		_, err := limiter.Allow(ctx, 1)
+		return err
+	}
+
+	store.SetDown(true)
+	for i := 0; i < 3; i++ {
+		if err := allow(); err != errDown {
+			t.Fatalf("#%d: Got (%v) != Want (%v)", i, err, errDown)
+		}
+	}
+	if !breaker.Open() {
+		t.Fatalf("Got closed circuit after 3 failures")
+	}
+
+	// The store is no longer hit while the circuit is open.
+	for i := 0; i < 5; i++ {
+		if err := allow(); err != ratelimiter.ErrCircuitOpen {
+			t.Fatalf("#%d: Got (%v) != Want (%v)", i, err, ratelimiter.ErrCircuitOpen)
+		}
+	}
+	if n := store.Calls(); n != 3 {
+		t.Fatalf("Got (%d) calls != Want (3)", n)
+	}
+
+	// A failed trial opens the circuit again.
+	clock.Advance(cooldown)
+	if err := allow(); err != errDown {
+		t.Fatalf("Got (%v) != Want (%v)", err, errDown)
+	}
+	if err := allow(); err != ratelimiter.ErrCircuitOpen {
+		t.Fatalf("Got (%v) != Want (%v)", err, ratelimiter.ErrCircuitOpen)
+	}
+
+	// A successful trial closes the circuit.
+	store.SetDown(false)
+	clock.Advance(cooldown)
+	for i := 0; i < 3; i++ {
+		if err := allow(); err != nil {
+			t.Fatalf("#%d: Err: %v", i, err)
+		}
+	}
+	if breaker.Open() {
+		t.Fatalf("Got open circuit after a successful trial")
+	}
+
+	// The failures must be consecutive to open the circuit.
+	for i := 0; i < 5; i++ {
+		store.SetDown(i%2 == 0)
+		allow()
+	}
+	if breaker.Open() {
+		t.Fatalf("Got open circuit after non-consecutive failures")
+	}
+}
+
+// funcStore is a Store whose executions are made by calling the function.
+type funcStore func(ctx context.Context) ([]int64, error)
+
+func (f funcStore) Exec(ctx context.Context, op *ratelimiter.Op, keys []string, args ...int64) ([]int64, error) {
+	return f(ctx)
+}
+
+func TestCircuitBreaker_Context(t *testing.T) {
+	// A hung store, which only fails when the context is done.
+	hung := funcStore(func(ctx context.Context) ([]int64, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	breaker := ratelimiter.NewCircuitBreaker(hung, 3, time.Minute)
+
+	// Cancellations are neither failures nor successes.
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		breaker.Exec(ctx, nil, nil)
+		cancel()
+	}
+	for i := 0; i < 5; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		breaker.Exec(ctx, nil, nil)
+	}
+	if breaker.Open() {
+		t.Fatalf("Got open circuit after 2 failures")
+	}
+
+	// Exceeding the deadline is a failure.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if _, err := breaker.Exec(ctx, nil, nil); err != context.DeadlineExceeded {
+		t.Fatalf("Got (%v) != Want (%v)", err, context.DeadlineExceeded)
+	}
+	if !breaker.Open() {
+		t.Fatalf("Got closed circuit after 3 failures")
+	}
+}
+
+func TestCircuitBreaker_StaleOperation(t *testing.T) {
+	// Each operation sends a channel, and then waits for its outcome on it.
+	calls := make(chan chan error)
+	store := funcStore(func(ctx context.Context) ([]int64, error) {
+		c := make(chan error)
+		calls <- c
+		return nil, <-c
+	})
+	clock := ratelimiter.NewFakeClock(time.Now())
+	breaker := ratelimiter.NewCircuitBreaker(store, 1, time.Second)
+	breaker.SetClock(clock)
+
+	// exec starts an operation, and returns the channel to send its
+	// outcome on, along with the channel to receive its error from.
+	exec := func() (chan<- error, <-chan error) {
+		errc := make(chan error, 1)
+		go func() {
+			_, err := breaker.Exec(context.Background(), nil, nil)
+			errc <- err
+		}()
+		return <-calls, errc
+	}
+
+	// The stale operation starts before the circuit opens.
+	stale, staleErr := exec()
+	failed, failedErr := exec()
+	failed <- errDown
+	<-failedErr
+	if !breaker.Open() {
+		t.Fatalf("Got closed circuit after 1 failure")
+	}
+
+	// The stale operation succeeds while the trial is running.
+	clock.Advance(time.Second)
+	trial, trialErr := exec()
+	stale <- nil
+	<-staleErr
+	if !breaker.Open() {
+		t.Fatalf("Got closed circuit after a stale success")
+	}
+
+	trial <- errDown
+	<-trialErr
+	if !breaker.Open() {
+		t.Fatalf("Got closed circuit after a failed trial")
+	}
+
+	// A trial is still let through after the cooldown.
+	clock.Advance(time.Second)
+	trial, trialErr = exec()
+	trial <- nil
+	if err := <-trialErr; err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if breaker.Open() {
+		t.Fatalf("Got open circuit after a successful trial")
+	}
+}
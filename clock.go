@@ -0,0 +1,114 @@
+package ratelimiter
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the source of time of the limiters, which is the system clock
+// by default, and can be replaced by a FakeClock to control time in tests.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// After waits for the duration d to elapse and then sends the current
+	// time on the returned channel.
+	After(d time.Duration) <-chan time.Time
+}
+
+// systemClock is the Clock backed by the functions of package time.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// FakeClock is a Clock that only moves forward when told to, which makes
+// the behavior of the limiters deterministic in tests.
+//
+// Note that the keys in Redis still expire in real time, after the TTLs
+// computed on the fake clock. If more real time elapses than fake time
+// (e.g. the clock is not advanced while the test sleeps), the state of
+// a limiter may expire early, and extra capacity is granted. A Memory only
+// expires its items on the fake clock if it is given by WithMemoryClock.
+type FakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	until time.Time
+	c     chan time.Time
+}
+
+// NewFakeClock returns a new fake clock whose current time is now.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now implements Clock by returning the current time of the fake clock.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After implements Clock by returning a channel, which receives the
+// current time once the fake clock has been moved by at least d.
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, fakeWaiter{until: c.now.Add(d), c: ch})
+	return ch
+}
+
+// Advance moves the fake clock forward by d.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.set(c.now.Add(d))
+}
+
+// Set moves the fake clock to t, which must not be before the current time.
+func (c *FakeClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.set(t)
+}
+
+// Waiters returns the number of the channels returned by After that are
+// still waiting, which helps tests to advance the clock only after the
+// limiters start waiting.
+func (c *FakeClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+func (c *FakeClock) set(t time.Time) {
+	if t.Before(c.now) {
+		return
+	}
+	c.now = t
+
+	waiting := c.waiters[:0]
+	for _, w := range c.waiters {
+		if t.Before(w.until) {
+			waiting = append(waiting, w)
+		} else {
+			w.c <- t
+		}
+	}
+	c.waiters = waiting
+}
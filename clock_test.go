@@ -0,0 +1,79 @@
+package ratelimiter_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RussellLuo/ratelimiter"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := ratelimiter.NewFakeClock(start)
+
+	c := clock.After(time.Second)
+	clock.Advance(999 * time.Millisecond)
+	select {
+	case <-c:
+		t.Fatal("After fired too early")
+	default:
+	}
+
+	clock.Advance(time.Millisecond)
+	select {
+	case now := <-c:
+		if want := start.Add(time.Second); !now.Equal(want) {
+			t.Errorf("Got (%v) != Want (%v)", now, want)
+		}
+	default:
+		t.Fatal("After did not fire")
+	}
+
+	// The fake clock never moves backward.
+	clock.Set(start)
+	if got, want := clock.Now(), start.Add(time.Second); !got.Equal(want) {
+		t.Errorf("Got (%v) != Want (%v)", got, want)
+	}
+}
+
+func TestFakeClock_Wait(t *testing.T) {
+	clock := ratelimiter.NewFakeClock(time.Now())
+	config := &ratelimiter.Config{
+		Interval: time.Hour,
+		Capacity: 1,
+	}
+
+	limiters := map[string]interface {
+		ratelimiter.Limiter
+		SetClock(ratelimiter.Clock)
+	}{
+		"tokenbucket": ratelimiter.NewTokenBucketWithStore(ratelimiter.NewMemory(ratelimiter.WithMemoryClock(clock)), "key", config),
+		"gcra":        ratelimiter.NewGCRAWithStore(ratelimiter.NewMemory(ratelimiter.WithMemoryClock(clock)), "key", config),
+	}
+	for name, limiter := range limiters {
+		limiter.SetClock(clock)
+		if err := limiter.Wait(context.Background(), 1); err != nil {
+			t.Fatalf("%s: Err: %v", name, err)
+		}
+
+		// The next one must wait for an hour on the fake clock.
+		done := make(chan error, 1)
+		go func() {
+			done <- limiter.Wait(context.Background(), 1)
+		}()
+		for clock.Waiters() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		select {
+		case err := <-done:
+			t.Fatalf("%s: Wait returned (%v) too early", name, err)
+		default:
+		}
+
+		clock.Advance(config.Interval)
+		if err := <-done; err != nil {
+			t.Errorf("%s: Err: %v", name, err)
+		}
+	}
+}
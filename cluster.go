@@ -0,0 +1,197 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrCrossSlot is returned by a RedisStore in cluster mode if the keys
+// that must be handled atomically are not in the same hash slot.
+var ErrCrossSlot = errors.New("ratelimiter: keys in different hash slots")
+
+// the number of hash slots in Redis Cluster
+const clusterSlots = 16384
+
+// the number of times a script is retried in cluster mode, if it fails
+// with a redirection or TRYAGAIN during resharding
+const clusterRetries = 3
+
+// WithCluster makes the store safe on Redis Cluster, where redis should be
+// a cluster client that routes each script by its first key, and follows
+// the MOVED and ASK redirections (e.g. redis.ClusterClient).
+//
+// In cluster mode, the keys of each operation must be in the same hash
+// slot (see HashTag), or Exec fails with ErrCrossSlot. A batch is split
+// into one script per hash slot, which are run concurrently, while an
+// all-or-nothing batch must be in a single hash slot. The scripts that
+// still fail with MOVED, ASK or TRYAGAIN, e.g. during resharding, are
+// retried a few times. The scripts are loaded on each node on demand,
+// since EVALSHA falls back to EVAL on NOSCRIPT, unless they are loaded
+// ahead of time (see LoadScripts).
+func WithCluster() RedisStoreOption {
+	return func(s *RedisStore) {
+		s.cluster = true
+	}
+}
+
+// HashTag returns the key of entity, which is wrapped in braces as the
+// hash tag of the key and followed by parts, all joined by ":". All the
+// keys of the same entity are in the same hash slot of Redis Cluster,
+// e.g. HashTag("org:7", "user:42") and HashTag("org:7") can be admitted
+// together by AllowAll.
+func HashTag(entity string, parts ...string) string {
+	return strings.Join(append([]string{"{" + entity + "}"}, parts...), ":")
+}
+
+// Slot returns the hash slot of key in Redis Cluster, which only hashes
+// the hash tag of key if any, i.e. the substring between the first "{"
+// and the following "}", as long as it is not empty.
+func Slot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16(key) % clusterSlots)
+}
+
+// crc16 returns the CRC16-CCITT (XMODEM) checksum of s, which is the one
+// used by Redis Cluster.
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// slotOf returns the hash slot of keys, or -1 if there is no key.
+// It returns ErrCrossSlot if keys are in different hash slots.
+func slotOf(keys []string) (int, error) {
+	slot := -1
+	for _, key := range keys {
+		s := Slot(key)
+		if slot >= 0 && s != slot {
+			return 0, ErrCrossSlot
+		}
+		slot = s
+	}
+	return slot, nil
+}
+
+// isRedirect reports whether err is a redirection of Redis Cluster,
+// or an error that is worth retrying during resharding.
+func isRedirect(err error) bool {
+	msg := err.Error()
+	for _, prefix := range []string{"MOVED ", "ASK ", "TRYAGAIN", "CLUSTERDOWN"} {
+		if strings.HasPrefix(msg, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// run runs script, which is retried on redirections in cluster mode.
+func (s *RedisStore) run(ctx context.Context, script *Script, keys []string, values []interface{}) (interface{}, error) {
+	for i := 0; ; i++ {
+		reply, err := script.RunContext(ctx, keys, values...)
+		if err == nil || !s.cluster || i == clusterRetries || !isRedirect(err) {
+			return reply, err
+		}
+		// Give the cluster client a moment to refresh its slot map.
+		if err := sleep(ctx, systemClock{}, time.Duration(i+1)*10*time.Millisecond); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// execSlots splits ops by hash slot in cluster mode, and executes each
+// group of ops in a batch of its own concurrently.
+func (s *RedisStore) execSlots(ctx context.Context, ops []BatchOp) ([][]int64, error) {
+	var slots []int
+	groups := make(map[int][]int)
+	for i, o := range ops {
+		slot, err := slotOf(o.Keys)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := groups[slot]; !ok {
+			slots = append(slots, slot)
+		}
+		groups[slot] = append(groups[slot], i)
+	}
+
+	replies := make([][]int64, len(ops))
+	errs := make([]error, len(slots))
+	var wg sync.WaitGroup
+	for j, slot := range slots {
+		wg.Add(1)
+		go func(j int, indexes []int) {
+			defer wg.Done()
+
+			group := make([]BatchOp, len(indexes))
+			for k, i := range indexes {
+				group[k] = ops[i]
+			}
+			groupReplies, err := s.execBatch(ctx, group, false)
+			if err != nil {
+				errs[j] = err
+				return
+			}
+			for k, i := range indexes {
+				replies[i] = groupReplies[k]
+			}
+		}(j, groups[slot])
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return replies, nil
+}
+
+// LoadScripts loads the scripts of all the operations ahead of time, if
+// redis implements ScriptLoader, which saves the first EVAL of each script
+// on each node. Otherwise, it does nothing, since the scripts are loaded
+// on demand anyway.
+//
+// The batch scripts, which are built for each combination of operations
+// run in batch, cannot be loaded ahead of time. In cluster mode, each of
+// them is loaded on every node once built instead, and LoadScripts loads
+// the ones built so far again, e.g. for the nodes added since.
+func (s *RedisStore) LoadScripts(ctx context.Context) error {
+	loader, ok := s.redis.(ScriptLoader)
+	if !ok {
+		return nil
+	}
+	scripts := make([]string, 0, len(registeredOps))
+	for _, op := range registeredOps {
+		scripts = append(scripts, op.script)
+	}
+	s.batches.Range(func(_, script interface{}) bool {
+		scripts = append(scripts, script.(*Script).src)
+		return true
+	})
+	for _, script := range scripts {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if _, err := loader.ScriptLoad(script); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package ratelimiter_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/RussellLuo/ratelimiter"
+	"github.com/go-redis/redis"
+)
+
+func TestSlot(t *testing.T) {
+	cases := []struct {
+		key  string
+		want int
+	}{
+		{key: "123456789", want: 12739},
+		{key: "foo", want: 12182},
+		{key: "{foo}:bar", want: 12182},
+		{key: "bar:{foo}", want: 12182},
+		// Only the first hash tag counts.
+		{key: "{foo}{bar}", want: 12182},
+	}
+	for _, c := range cases {
+		if got := ratelimiter.Slot(c.key); got != c.want {
+			t.Errorf("%s: Got (%d) != Want (%d)", c.key, got, c.want)
+		}
+	}
+
+	// An empty hash tag hashes the whole key.
+	if ratelimiter.Slot("{}foo") == ratelimiter.Slot("foo") {
+		t.Errorf("Got the slot of an empty hash tag == the slot of the tag")
+	}
+}
+
+func TestHashTag(t *testing.T) {
+	cases := []struct {
+		entity string
+		parts  []string
+		want   string
+	}{
+		{entity: "org:7", want: "{org:7}"},
+		{entity: "org:7", parts: []string{"user:42"}, want: "{org:7}:user:42"},
+		{entity: "org:7", parts: []string{"user:42", "login"}, want: "{org:7}:user:42:login"},
+	}
+	for _, c := range cases {
+		got := ratelimiter.HashTag(c.entity, c.parts...)
+		if got != c.want {
+			t.Errorf("Got (%s) != Want (%s)", got, c.want)
+		}
+		if ratelimiter.Slot(got) != ratelimiter.Slot(c.entity) {
+			t.Errorf("%s: Got a slot other than the slot of the entity", got)
+		}
+	}
+}
+
+// redirectingRedis fails the first scripts with a MOVED redirection,
+// which mimics a cluster client during resharding.
+type redirectingRedis struct {
+	Redis
+	redirects int32
+}
+
+func (r *redirectingRedis) EvalShaContext(ctx context.Context, sha1 string, keys []string, args ...interface{}) (interface{}, error, bool) {
+	if atomic.AddInt32(&r.redirects, -1) >= 0 {
+		return nil, errors.New("MOVED 3999 127.0.0.1:6381"), false
+	}
+	return r.Redis.EvalShaContext(ctx, sha1, keys, args...)
+}
+
+func TestRedisStore_Cluster(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	counting := &countingRedis{Redis: Redis{client}}
+	store := ratelimiter.NewRedisStore(counting, ratelimiter.WithCluster())
+	config := &ratelimiter.Config{
+		Interval: time.Second,
+		Capacity: 5,
+	}
+
+	keys := []string{
+		ratelimiter.HashTag("org:1", "user:1"),
+		ratelimiter.HashTag("org:1"),
+		ratelimiter.HashTag("org:2", "user:2"),
+		ratelimiter.HashTag("org:2"),
+	}
+	client.Del(keys...)
+	var checks []ratelimiter.Check
+	for _, key := range keys {
+		checks = append(checks, ratelimiter.Check{
+			Limiter: ratelimiter.NewTokenBucketWithStore(store, key, config),
+			Amount:  1,
+		})
+	}
+
+	// The batch is split into one script per hash slot.
+	runs := counting.Runs()
+	results, err := ratelimiter.AllowBatch(context.Background(), checks...)
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	for i, r := range results {
+		if !r.Allowed || r.Remaining != 4 {
+			t.Errorf("#%d: Got (%#v) != Want (Allowed: true, Remaining: 4)", i, r)
+		}
+	}
+	if n := counting.Runs() - runs; n != 2 {
+		t.Errorf("Got (%d) round trips != Want (2)", n)
+	}
+
+	// An all-or-nothing batch must be in a single hash slot.
+	if _, err := ratelimiter.AllowAll(context.Background(), checks...); err != ratelimiter.ErrCrossSlot {
+		t.Errorf("Got (%v) != Want (%v)", err, ratelimiter.ErrCrossSlot)
+	}
+	if _, err := ratelimiter.AllowAll(context.Background(), checks[:2]...); err != nil {
+		t.Errorf("Err: %v", err)
+	}
+}
+
+func TestRedisStore_ClusterRedirect(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	key := ratelimiter.HashTag("ratelimiter:cluster:test")
+	client.Del(key)
+	config := &ratelimiter.Config{
+		Interval: time.Second,
+		Capacity: 5,
+	}
+
+	cases := []struct {
+		name  string
+		opts  []ratelimiter.RedisStoreOption
+		moved int32
+		ok    bool
+	}{
+		{name: "standalone", moved: 1, ok: false},
+		{name: "cluster", opts: []ratelimiter.RedisStoreOption{ratelimiter.WithCluster()}, moved: 2, ok: true},
+		{name: "cluster retries exceeded", opts: []ratelimiter.RedisStoreOption{ratelimiter.WithCluster()}, moved: 10, ok: false},
+	}
+	for _, c := range cases {
+		r := &redirectingRedis{Redis: Redis{client}, redirects: c.moved}
+		bucket := ratelimiter.NewTokenBucketWithStore(ratelimiter.NewRedisStore(r, c.opts...), key, config)
+		_, err := bucket.Allow(context.Background(), 1)
+		if (err == nil) != c.ok {
+			t.Errorf("%s: Got (%v), Want ok: %v", c.name, err, c.ok)
+		}
+	}
+}
+
+// loadingRedis implements ratelimiter.ScriptLoader.
+type loadingRedis struct {
+	Redis
+	hashes []string
+}
+
+func (r *loadingRedis) ScriptLoad(script string) (string, error) {
+	hash, err := r.client.ScriptLoad(script).Result()
+	if err == nil {
+		r.hashes = append(r.hashes, hash)
+	}
+	return hash, err
+}
+
+func TestRedisStore_LoadScripts(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	r := &loadingRedis{Redis: Redis{client}}
+	store := ratelimiter.NewRedisStore(r, ratelimiter.WithCluster())
+
+	if err := store.LoadScripts(context.Background()); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if len(r.hashes) == 0 {
+		t.Fatalf("Got no script loaded")
+	}
+	exists, err := client.ScriptExists(r.hashes...).Result()
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	for i, ok := range exists {
+		if !ok {
+			t.Errorf("Got script %s not loaded", r.hashes[i])
+		}
+	}
+}
+
+func TestRedisStore_LoadBatchScripts(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	r := &loadingRedis{Redis: Redis{client}}
+	store := ratelimiter.NewRedisStore(r, ratelimiter.WithCluster())
+
+	if err := store.LoadScripts(context.Background()); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	ops := len(r.hashes)
+
+	prefix := ratelimiter.HashTag("ratelimiter:cluster:batch:test")
+	client.Del(prefix+":user", prefix+":org")
+	config := &ratelimiter.Config{
+		Interval: time.Second,
+		Capacity: 5,
+	}
+	checks := []ratelimiter.Check{
+		{Limiter: ratelimiter.NewTokenBucketWithStore(store, prefix+":user", config), Amount: 1},
+		{Limiter: ratelimiter.NewGCRAWithStore(store, prefix+":org", config), Amount: 1},
+	}
+
+	// The batch script is loaded once built.
+	for i := 0; i < 2; i++ {
+		if _, err := ratelimiter.AllowBatch(context.Background(), checks...); err != nil {
+			t.Fatalf("Err: %v", err)
+		}
+	}
+	if n := len(r.hashes) - ops; n != 1 {
+		t.Fatalf("Got (%d) batch scripts loaded != Want (1)", n)
+	}
+	batch := r.hashes[ops]
+
+	// And loaded again along with the scripts of the operations.
+	r.hashes = nil
+	if err := store.LoadScripts(context.Background()); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if len(r.hashes) != ops+1 || r.hashes[ops] != batch {
+		t.Errorf("Got (%d) scripts loaded != Want (%d) with the batch script", len(r.hashes), ops+1)
+	}
+}
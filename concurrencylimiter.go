@@ -0,0 +1,368 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrLeaseExpired is returned by Lease.Renew if the lease has expired,
+// or has been released, in which case it may have been reclaimed by others.
+var ErrLeaseExpired = errors.New("ratelimiter: lease expired")
+
+// the Lua script that acquires a lease for the Concurrency Limiter.
+// Each lease is a member of a sorted set, whose score is the timestamp
+// of the time it expires, and whose name is the ID of the lease.
+const luaConcurrencyAcquire = luaClock + `
+local key = KEYS[1]
+local ttl = tonumber(ARGV[1])
+local capacity = tonumber(ARGV[2])
+local now = clock(tonumber(ARGV[3]))
+local id = ARGV[4]
+
+redis.call("zremrangebyscore", key, "-inf", string.format("%.f", now))
+local count = redis.call("zcard", key)
+
+local allowed = 0
+local retry_after = 0
+if count < capacity then
+  redis.call("zadd", key, string.format("%.f", now + ttl), id)
+  count = count + 1
+  allowed = 1
+else
+  local oldest = redis.call("zrange", key, 0, 0, "withscores")
+  retry_after = tonumber(oldest[2]) - now
+end
+
+local reset_after = 0
+if count > 0 then
+  local newest = redis.call("zrange", key, -1, -1, "withscores")
+  reset_after = tonumber(newest[2]) - now
+  redis.call("pexpire", key, string.format("%.f", math.ceil(reset_after / 1000)))
+end
+
+return {allowed, capacity - count, 0, retry_after, reset_after}
+`
+
+// the Lua script that extends the expiry of a lease, if it has not expired yet.
+const luaConcurrencyRenew = luaClock + `
+local key = KEYS[1]
+local ttl = tonumber(ARGV[1])
+local now = clock(tonumber(ARGV[2]))
+local id = ARGV[3]
+
+local expiry = redis.call("zscore", key, id)
+if not expiry or tonumber(expiry) <= now then
+  redis.call("zrem", key, id)
+  return {0}
+end
+
+redis.call("zadd", key, string.format("%.f", now + ttl), id)
+local newest = redis.call("zrange", key, -1, -1, "withscores")
+redis.call("pexpire", key, string.format("%.f", math.ceil((tonumber(newest[2]) - now) / 1000)))
+return {1}
+`
+
+// the Lua script that releases a lease.
+const luaConcurrencyRelease = `
+local key = KEYS[1]
+local id = ARGV[1]
+
+return {redis.call("zrem", key, id)}
+`
+
+// concurrencyLease is the Go equivalent of a member in luaConcurrencyAcquire.
+type concurrencyLease struct {
+	expiry int64
+	id     int64
+}
+
+func loadConcurrencyLeases(tx Tx, key string) ([]concurrencyLease, error) {
+	value, ok, err := tx.Get(key)
+	if err != nil || !ok {
+		return nil, err
+	}
+	fields, err := decodeFields(value)
+	if err != nil || len(fields)%2 != 0 {
+		return nil, errWrongType
+	}
+
+	leases := make([]concurrencyLease, len(fields)/2)
+	for i := range leases {
+		leases[i] = concurrencyLease{expiry: fields[2*i], id: fields[2*i+1]}
+	}
+	return leases, nil
+}
+
+// saveConcurrencyLeases saves the leases not expired at now, sorted by expiry,
+// with the key expiring when the newest lease expires.
+func saveConcurrencyLeases(tx Tx, key string, leases []concurrencyLease, now int64) error {
+	live := leases[:0]
+	for _, l := range leases {
+		if l.expiry > now {
+			live = append(live, l)
+		}
+	}
+	leases = live
+	if len(leases) == 0 {
+		return tx.Del(key)
+	}
+
+	sort.SliceStable(leases, func(i, j int) bool {
+		return leases[i].expiry < leases[j].expiry
+	})
+	fields := make([]int64, 0, 2*len(leases))
+	for _, l := range leases {
+		fields = append(fields, l.expiry, l.id)
+	}
+	ttl := time.Duration(ceilDiv(leases[len(leases)-1].expiry-now, 1000)) * time.Millisecond
+	return tx.Set(key, encodeState(fields...), ttl)
+}
+
+// concurrencyAcquire is the Go function equivalent to luaConcurrencyAcquire.
+func concurrencyAcquire(tx Tx, keys []string, args []int64) ([]int64, error) {
+	key := keys[0]
+	ttl, capacity, now, id := args[0], args[1], args[2], args[3]
+
+	leases, err := loadConcurrencyLeases(tx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	// Reclaim the expired leases, keeping the rest sorted by expiry.
+	live := leases[:0]
+	for _, l := range leases {
+		if l.expiry > now {
+			live = append(live, l)
+		}
+	}
+	leases = live
+	count := int64(len(leases))
+
+	var allowed, retryAfter int64
+	if count < capacity {
+		leases = append(leases, concurrencyLease{expiry: now + ttl, id: id})
+		count = count + 1
+		allowed = 1
+	} else {
+		retryAfter = leases[0].expiry - now
+	}
+
+	var resetAfter int64
+	for _, l := range leases {
+		resetAfter = maxInt64(resetAfter, l.expiry-now)
+	}
+
+	if err := saveConcurrencyLeases(tx, key, leases, now); err != nil {
+		return nil, err
+	}
+
+	return []int64{allowed, capacity - count, 0, retryAfter, resetAfter}, nil
+}
+
+// concurrencyRenew is the Go function equivalent to luaConcurrencyRenew.
+func concurrencyRenew(tx Tx, keys []string, args []int64) ([]int64, error) {
+	key := keys[0]
+	ttl, now, id := args[0], args[1], args[2]
+
+	leases, err := loadConcurrencyLeases(tx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, l := range leases {
+		if l.id != id {
+			continue
+		}
+		if l.expiry <= now {
+			leases = append(leases[:i], leases[i+1:]...)
+			if err := saveConcurrencyLeases(tx, key, leases, now); err != nil {
+				return nil, err
+			}
+			return []int64{0}, nil
+		}
+		leases[i].expiry = now + ttl
+		if err := saveConcurrencyLeases(tx, key, leases, now); err != nil {
+			return nil, err
+		}
+		return []int64{1}, nil
+	}
+	return []int64{0}, nil
+}
+
+// concurrencyRelease is the Go function equivalent to luaConcurrencyRelease.
+func concurrencyRelease(tx Tx, keys []string, args []int64) ([]int64, error) {
+	key := keys[0]
+	id, now := args[0], args[1]
+
+	leases, err := loadConcurrencyLeases(tx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, l := range leases {
+		if l.id == id {
+			leases = append(leases[:i], leases[i+1:]...)
+			if err := saveConcurrencyLeases(tx, key, leases, now); err != nil {
+				return nil, err
+			}
+			return []int64{1}, nil
+		}
+	}
+	return []int64{0}, nil
+}
+
+var (
+	concurrencyAcquireOp = newOp("concurrency.acquire", luaConcurrencyAcquire, 2, concurrencyAcquire)
+	concurrencyRenewOp   = newOp("concurrency.renew", luaConcurrencyRenew, 1, concurrencyRenew)
+	concurrencyReleaseOp = newOp("concurrency.release", luaConcurrencyRelease, 1, concurrencyRelease)
+)
+
+// ConcurrencyLimiter limits the number of leases held at the same time,
+// e.g. the number of in-flight jobs of a tenant across all the instances
+// of a service, which is different from limiting the rate of the jobs.
+//
+// Each lease expires after Interval, so that the leases held by crashed
+// holders are eventually reclaimed. Holders of long jobs must renew their
+// leases before they expire.
+type ConcurrencyLimiter struct {
+	baseBucket
+
+	store Store
+	key   string
+}
+
+// NewConcurrencyLimiter returns a new concurrency limiter special for key
+// in redis with the specified configuration.
+func NewConcurrencyLimiter(redis Redis, key string, config *Config) *ConcurrencyLimiter {
+	return NewConcurrencyLimiterWithStore(NewRedisStore(redis), key, config)
+}
+
+// NewConcurrencyLimiterWithStore returns a new concurrency limiter special for key
+// in store with the specified configuration.
+func NewConcurrencyLimiterWithStore(store Store, key string, config *Config) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{
+		baseBucket: baseBucket{config: config},
+		store:      store,
+		key:        key,
+	}
+}
+
+// Acquire tries to acquire a lease. The returned lease is not OK if there
+// are already Capacity leases held, in which case Result().RetryAfter is
+// the duration after which the oldest lease expires if it is not released
+// or renewed by then.
+func (c *ConcurrencyLimiter) Acquire(ctx context.Context) (*Lease, error) {
+	config := c.Config()
+	if config.Capacity < 1 {
+		return &Lease{result: newUnsatisfiableResult(config.Capacity)}, nil
+	}
+
+	id := newID()
+	now := c.Clock().Now().UnixNano()
+	reply, err := c.store.Exec(
+		ctx,
+		concurrencyAcquireOp,
+		[]string{c.key},
+		int64(config.Interval/time.Microsecond),
+		config.Capacity,
+		int64(time.Duration(now)/time.Microsecond),
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := parseResult(reply, config.Capacity, time.Unix(0, now))
+	if err != nil {
+		return nil, err
+	}
+	return &Lease{result: result, limiter: c, id: id}, nil
+}
+
+// Lease is a slot of a ConcurrencyLimiter, which is held until it is
+// released or expires.
+type Lease struct {
+	result  Result
+	limiter *ConcurrencyLimiter
+	id      int64
+
+	mu       sync.Mutex
+	released bool
+}
+
+// OK reports whether the limiter granted the lease.
+func (l *Lease) OK() bool {
+	return l.result.Allowed
+}
+
+// Result returns the result of acquiring the lease.
+func (l *Lease) Result() Result {
+	return l.result
+}
+
+// Renew extends the lease to expire after another Interval from now.
+// It returns ErrLeaseExpired if the lease is not OK, has been released,
+// or has already expired.
+func (l *Lease) Renew(ctx context.Context) error {
+	if !l.OK() {
+		return ErrLeaseExpired
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.released {
+		return ErrLeaseExpired
+	}
+
+	c := l.limiter
+	now := c.Clock().Now().UnixNano()
+	reply, err := c.store.Exec(
+		ctx,
+		concurrencyRenewOp,
+		[]string{c.key},
+		int64(c.Config().Interval/time.Microsecond),
+		int64(time.Duration(now)/time.Microsecond),
+		l.id,
+	)
+	if err != nil {
+		return err
+	}
+	if len(reply) != 1 || reply[0] != 1 {
+		return ErrLeaseExpired
+	}
+	return nil
+}
+
+// Release returns the lease back to the limiter. Release is a no-op if
+// the lease is not OK or has already been released.
+func (l *Lease) Release(ctx context.Context) error {
+	if !l.OK() {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.released {
+		return nil
+	}
+
+	c := l.limiter
+	now := c.Clock().Now().UnixNano()
+	_, err := c.store.Exec(
+		ctx,
+		concurrencyReleaseOp,
+		[]string{c.key},
+		l.id,
+		int64(time.Duration(now)/time.Microsecond),
+	)
+	if err != nil {
+		return err
+	}
+	l.released = true
+	return nil
+}
@@ -0,0 +1,28 @@
+package ratelimiter_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RussellLuo/ratelimiter"
+	"github.com/go-redis/redis"
+)
+
+func BenchmarkConcurrencyLimiter_Acquire(b *testing.B) {
+	limiter := ratelimiter.NewConcurrencyLimiter(
+		&Redis{redis.NewClient(&redis.Options{
+			Addr: "localhost:6379",
+		})},
+		"ratelimiter:concurrency:benchmark",
+		&ratelimiter.Config{
+			Interval: 1 * time.Second,
+			Capacity: 5,
+		},
+	)
+	for i := 0; i < b.N; i++ {
+		if lease, err := limiter.Acquire(context.Background()); err == nil {
+			lease.Release(context.Background())
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package ratelimiter_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RussellLuo/ratelimiter"
+	"github.com/go-redis/redis"
+)
+
+func TestConcurrencyLimiter_Acquire(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	key := "ratelimiter:concurrency:test"
+	config := &ratelimiter.Config{
+		Interval: 1 * time.Second / 2,
+		Capacity: 2,
+	}
+
+	clock := ratelimiter.NewFakeClock(time.Now())
+
+	stores := map[string]ratelimiter.Store{
+		"redis":  ratelimiter.NewRedisStore(&Redis{client}),
+		"memory": ratelimiter.NewMemory(ratelimiter.WithMemoryClock(clock)),
+	}
+	for name, store := range stores {
+		client.Del(key)
+		limiter := ratelimiter.NewConcurrencyLimiterWithStore(store, key, config)
+		limiter.SetClock(clock)
+		ctx := context.Background()
+
+		acquire := func(wantOK bool) *ratelimiter.Lease {
+			lease, err := limiter.Acquire(ctx)
+			if err != nil {
+				t.Fatalf("%s: Err: %v", name, err)
+			}
+			if lease.OK() != wantOK {
+				t.Fatalf("%s: Got OK (%v) != Want (%v)", name, lease.OK(), wantOK)
+			}
+			return lease
+		}
+
+		first := acquire(true)
+		second := acquire(true)
+		if r := acquire(false).Result(); r.RetryAfter != config.Interval {
+			t.Errorf("%s: Got RetryAfter (%v) != Want (%v)", name, r.RetryAfter, config.Interval)
+		}
+
+		// Releasing a lease makes room for another one.
+		if err := first.Release(ctx); err != nil {
+			t.Fatalf("%s: Err: %v", name, err)
+		}
+		third := acquire(true)
+
+		// Renewing keeps the lease alive, while the others are reclaimed
+		// once they expire.
+		clock.Advance(config.Interval / 2)
+		if err := third.Renew(ctx); err != nil {
+			t.Fatalf("%s: Err: %v", name, err)
+		}
+		clock.Advance(config.Interval / 2)
+		acquire(true)
+		acquire(false)
+		if err := second.Renew(ctx); err != ratelimiter.ErrLeaseExpired {
+			t.Errorf("%s: Got (%v) != Want (%v)", name, err, ratelimiter.ErrLeaseExpired)
+		}
+		if err := first.Renew(ctx); err != ratelimiter.ErrLeaseExpired {
+			t.Errorf("%s: Got (%v) != Want (%v)", name, err, ratelimiter.ErrLeaseExpired)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+)
+
+type failureMode int
+
+const (
+	failWithError failureMode = iota
+	failOpen
+	failClosed
+	failLocal
+)
+
+// FailurePolicy decides the result of a request when the store of
+// a limiter fails, e.g. when Redis is unreachable. The zero value returns
+// the error of the store to the caller, which is the default.
+type FailurePolicy struct {
+	mode       failureMode
+	retryAfter time.Duration
+	fraction   float64
+}
+
+// FailOpen returns a policy that allows all the requests while the store
+// is failing, which favors availability over protection.
+func FailOpen() FailurePolicy {
+	return FailurePolicy{mode: failOpen}
+}
+
+// FailClosed returns a policy that denies all the requests while the store
+// is failing, which are told to retry after the duration retryAfter.
+// It panics if retryAfter is not positive, which would make Wait retry
+// the failing store in a busy loop.
+func FailClosed(retryAfter time.Duration) FailurePolicy {
+	if retryAfter <= 0 {
+		panic("ratelimiter: non-positive retry-after duration")
+	}
+	return FailurePolicy{mode: failClosed, retryAfter: retryAfter}
+}
+
+// FailLocal returns a policy that falls back to a local in-memory limiter
+// of the same algorithm while the store is failing, whose capacity (and
+// rate, for the bucket algorithms) is fraction of the configured one.
+// For example, a fraction of 1/N keeps the overall limit of N instances
+// roughly unchanged. The capacity of the local limiter is at least 1.
+// It panics if fraction is not in (0, 1].
+func FailLocal(fraction float64) FailurePolicy {
+	if !(fraction > 0 && fraction <= 1) {
+		panic("ratelimiter: fraction out of (0, 1]")
+	}
+	return FailurePolicy{mode: failLocal, fraction: fraction}
+}
+
+// localConfig returns the configuration of the local limiter of algorithm,
+// which is scaled down from config by the fraction of the policy.
+func (p FailurePolicy) localConfig(algorithm Algorithm, config Config) *Config {
+	config.Capacity = int64(math.Max(1, math.Floor(float64(config.Capacity)*p.fraction)))
+	switch algorithm {
+	case AlgorithmTokenBucket, AlgorithmLeakyBucket, AlgorithmGCRA:
+		// Interval is the time per unit, so the rate is scaled by
+		// scaling Interval inversely.
+		config.Interval = time.Duration(float64(config.Interval) / p.fraction)
+	}
+	return &config
+}
+
+// FailSafe is a Limiter that applies a failure policy when the underlying
+// limiter fails, which is typically wrapped around a limiter on a
+// CircuitBreaker to stop hammering a dead Redis.
+//
+// The errors of ctx itself are always returned as is.
+type FailSafe struct {
+	limiter Limiter
+	policy  FailurePolicy
+	local   Limiter
+	clock   Clock
+}
+
+// NewFailSafe returns a new limiter that applies policy when l fails.
+// It panics if policy is FailLocal and l is not one of the algorithms
+// in this package.
+//
+// For FailLocal, the local limiter is created from the configuration
+// of l at the time of the call.
+func NewFailSafe(l Limiter, policy FailurePolicy) *FailSafe {
+	f := &FailSafe{limiter: l, policy: policy, clock: systemClock{}}
+	if c, ok := l.(interface{ Clock() Clock }); ok {
+		f.clock = c.Clock()
+	}
+
+	if policy.mode == failLocal {
+		algorithm, key, config := algorithmOf(l)
+		if algorithm == 0 {
+			panic("ratelimiter: no local fallback for the limiter")
+		}
+		f.local = newLocalLimiter(NewMemory(WithMemoryClock(f.clock)), algorithm, key, policy.localConfig(algorithm, config), f.clock)
+	}
+	return f
+}
+
+// newLocalLimiter returns a new limiter of algorithm on the local store.
+func newLocalLimiter(store *Memory, algorithm Algorithm, key string, config *Config, clock Clock) Limiter {
+	l, setClock := algorithm.newLimiter(store, key, config)
+	setClock(clock)
+	return l
+}
+
+// algorithmOf returns the algorithm, key and configuration of l,
+// or a zero algorithm if l is not one of the algorithms in this package.
+func algorithmOf(l Limiter) (Algorithm, string, Config) {
+	switch l := l.(type) {
+	case *TokenBucket:
+		return AlgorithmTokenBucket, l.key, l.Config()
+	case *LeakyBucket:
+		return AlgorithmLeakyBucket, l.key, l.Config()
+	case *GCRA:
+		return AlgorithmGCRA, l.key, l.Config()
+	case *SlidingWindowLog:
+		return AlgorithmSlidingWindowLog, l.key, l.Config()
+	case *SlidingWindowCounter:
+		return AlgorithmSlidingWindowCounter, l.key, l.Config()
+	case *FixedWindow:
+		return AlgorithmFixedWindow, l.key, l.Config()
+	default:
+		return 0, "", Config{}
+	}
+}
+
+// Allow reports whether amount units are allowed to pass.
+func (f *FailSafe) Allow(ctx context.Context, amount int64) (Result, error) {
+	result, err := f.limiter.Allow(ctx, amount)
+	if err == nil || !f.applies(ctx, err) {
+		return result, err
+	}
+
+	if f.policy.mode == failLocal {
+		return f.local.Allow(ctx, amount)
+	}
+	return f.fallback(), nil
+}
+
+// Wait blocks until amount units are allowed to pass.
+func (f *FailSafe) Wait(ctx context.Context, amount int64) error {
+	return wait(ctx, f, amount)
+}
+
+// Reserve reserves amount units, which may be returned back by
+// cancelling the reservation if they end up unused.
+func (f *FailSafe) Reserve(ctx context.Context, amount int64) (*Reservation, error) {
+	r, err := f.limiter.Reserve(ctx, amount)
+	if err == nil || !f.applies(ctx, err) {
+		return r, err
+	}
+
+	if f.policy.mode == failLocal {
+		return f.local.Reserve(ctx, amount)
+	}
+	return newReservation(f.fallback(), f.clock, func(ctx context.Context) error {
+		return nil
+	}), nil
+}
+
+// applies reports whether the policy applies to err.
+func (f *FailSafe) applies(ctx context.Context, err error) bool {
+	if f.policy.mode == failWithError || ctx.Err() != nil {
+		return false
+	}
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+// fallback returns the result of FailOpen or FailClosed.
+func (f *FailSafe) fallback() Result {
+	var limit int64
+	if c, ok := f.limiter.(interface{ Config() Config }); ok {
+		limit = c.Config().Capacity
+	}
+
+	if f.policy.mode == failOpen {
+		return Result{
+			Allowed:   true,
+			Limit:     limit,
+			Remaining: limit,
+			ResetAt:   f.clock.Now(),
+		}
+	}
+	return Result{
+		Limit:      limit,
+		RetryAfter: f.policy.retryAfter,
+		ResetAfter: f.policy.retryAfter,
+		ResetAt:    f.clock.Now().Add(f.policy.retryAfter),
+	}
+}
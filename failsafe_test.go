@@ -0,0 +1,168 @@
+package ratelimiter_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RussellLuo/ratelimiter"
+)
+
+func TestFailSafe_Allow(t *testing.T) {
+	config := &ratelimiter.Config{
+		Interval: time.Second / 10,
+		Capacity: 10,
+	}
+
+	cases := []struct {
+		name   string
+		policy ratelimiter.FailurePolicy
+		want   []ratelimiter.Result
+		err    error
+	}{
+		{
+			name:   "error",
+			policy: ratelimiter.FailurePolicy{},
+			err:    errDown,
+		},
+		{
+			name:   "open",
+			policy: ratelimiter.FailOpen(),
+			want: []ratelimiter.Result{
+				{Allowed: true, Limit: 10, Remaining: 10},
+				{Allowed: true, Limit: 10, Remaining: 10},
+				{Allowed: true, Limit: 10, Remaining: 10},
+			},
+		},
+		{
+			name:   "closed",
+			policy: ratelimiter.FailClosed(time.Second),
+			want: []ratelimiter.Result{
+				{Allowed: false, Limit: 10, RetryAfter: time.Second},
+				{Allowed: false, Limit: 10, RetryAfter: time.Second},
+				{Allowed: false, Limit: 10, RetryAfter: time.Second},
+			},
+		},
+		// The local limiter has a half of the capacity.
+		{
+			name:   "local",
+			policy: ratelimiter.FailLocal(0.5),
+			want: []ratelimiter.Result{
+				{Allowed: true, Limit: 5, Remaining: 3},
+				{Allowed: true, Limit: 5, Remaining: 1},
+				{Allowed: false, Limit: 5, Remaining: 1, RetryAfter: 200 * time.Millisecond},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		store := newDownStore()
+		clock := ratelimiter.NewFakeClock(time.Now())
+		tb := ratelimiter.NewTokenBucketWithStore(store, "ratelimiter:failsafe:test", config)
+		tb.SetClock(clock)
+		limiter := ratelimiter.NewFailSafe(tb, c.policy)
+
+		// The policy does not apply while the store is up.
+		got, err := limiter.Allow(context.Background(), 4)
+		if err != nil {
+			t.Fatalf("%s: Err: %v", c.name, err)
+		}
+		if !(got.Allowed && got.Limit == 10 && got.Remaining == 6) {
+			t.Errorf("%s: Got (%#v) is not allowed by the store", c.name, got)
+		}
+
+		store.SetDown(true)
+		for i := 0; i < 3; i++ {
+			got, err := limiter.Allow(context.Background(), 2)
+			if err != c.err {
+				t.Fatalf("%s: #%d: Got (%v) != Want (%v)", c.name, i, err, c.err)
+			}
+			if err != nil {
+				continue
+			}
+			want := c.want[i]
+			if !(got.Allowed == want.Allowed && got.Limit == want.Limit && got.Remaining == want.Remaining && got.RetryAfter == want.RetryAfter) {
+				t.Errorf("%s: #%d: Got (%#v) != Want (%#v)", c.name, i, got, want)
+			}
+		}
+	}
+}
+
+func TestFailSafe_Context(t *testing.T) {
+	store := newDownStore()
+	store.SetDown(true)
+	limiter := ratelimiter.NewFailSafe(
+		ratelimiter.NewTokenBucketWithStore(store, "ratelimiter:failsafe:test", &ratelimiter.Config{
+			Interval: time.Second,
+			Capacity: 10,
+		}),
+		ratelimiter.FailOpen(),
+	)
+
+	// The errors of the context are not subject to the policy.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := limiter.Allow(ctx, 1); err != errDown {
+		t.Errorf("Got (%v) != Want (%v)", err, errDown)
+	}
+}
+
+func TestFailurePolicy_Invalid(t *testing.T) {
+	cases := []struct {
+		name   string
+		policy func() ratelimiter.FailurePolicy
+	}{
+		{
+			name:   "zero retry-after",
+			policy: func() ratelimiter.FailurePolicy { return ratelimiter.FailClosed(0) },
+		},
+		{
+			name:   "negative retry-after",
+			policy: func() ratelimiter.FailurePolicy { return ratelimiter.FailClosed(-time.Second) },
+		},
+		{
+			name:   "zero fraction",
+			policy: func() ratelimiter.FailurePolicy { return ratelimiter.FailLocal(0) },
+		},
+		{
+			name:   "fraction above 1",
+			policy: func() ratelimiter.FailurePolicy { return ratelimiter.FailLocal(1.5) },
+		},
+	}
+
+	for _, c := range cases {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: Got no panic", c.name)
+				}
+			}()
+			c.policy()
+		}()
+	}
+}
+
+func TestKeyedLimiter_SetFailurePolicy(t *testing.T) {
+	store := newDownStore()
+	clock := ratelimiter.NewFakeClock(time.Now())
+	limiter := ratelimiter.NewKeyedLimiterWithStore(store, "ratelimiter:keyed:failsafe:test", ratelimiter.AlgorithmFixedWindow, &ratelimiter.Config{
+		Interval: time.Minute,
+		Capacity: 4,
+	})
+	limiter.SetClock(clock)
+	limiter.SetFailurePolicy(ratelimiter.FailLocal(0.5))
+	store.SetDown(true)
+
+	// The local limiters keep their state across calls, per key.
+	for _, key := range []string{"alice", "bob"} {
+		for i, want := range []bool{true, true, false} {
+			got, err := limiter.Allow(context.Background(), key, 1)
+			if err != nil {
+				t.Fatalf("%s: #%d: Err: %v", key, i, err)
+			}
+			if got.Allowed != want || got.Limit != 2 {
+				t.Errorf("%s: #%d: Got (%#v) != Want (Allowed: %v, Limit: 2)", key, i, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package ratelimiter
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// the Lua script that implements the Fixed Window Counter Algorithm.
+// The key is specific to the current window, which ends at reset_at.
+const luaFixedWindow = `
+local key = KEYS[1]
+local capacity = tonumber(ARGV[1])
+local now = tonumber(ARGV[2])
+local amount = tonumber(ARGV[3])
+local reset_at = tonumber(ARGV[4])
+
+local count = tonumber(redis.call("get", key) or "0")
+
+local allowed = 0
+local retry_after = 0
+if count + amount <= capacity then
+  count = redis.call("incrby", key, amount)
+  redis.call("pexpire", key, string.format("%.f", math.ceil((reset_at - now) / 1000)))
+  allowed = 1
+else
+  retry_after = reset_at - now
+end
+
+local reset_after = 0
+if count > 0 then
+  reset_after = reset_at - now
+end
+
+return {allowed, capacity - count, 0, retry_after, reset_after}
+`
+
+// the Lua script that takes amount units out of the window, if the window
+// has not ended yet.
+const luaFixedWindowRefund = `
+local key = KEYS[1]
+local amount = tonumber(ARGV[1])
+
+local count = tonumber(redis.call("get", key) or "0")
+if count <= 0 then
+  return {0}
+end
+
+redis.call("decrby", key, math.min(amount, count))
+return {1}
+`
+
+// fixedWindow is the Go function equivalent to luaFixedWindow.
+func fixedWindow(tx Tx, keys []string, args []int64) ([]int64, error) {
+	key := keys[0]
+	capacity, now, amount, resetAt := args[0], args[1], args[2], args[3]
+
+	var count int64
+	value, ok, err := tx.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		if err := decodeState(value, &count); err != nil {
+			return nil, err
+		}
+	}
+
+	var allowed, retryAfter int64
+	if count+amount <= capacity {
+		count = count + amount
+		ttl := time.Duration(ceilDiv(resetAt-now, 1000)) * time.Millisecond
+		if err := tx.Set(key, encodeState(count), ttl); err != nil {
+			return nil, err
+		}
+		allowed = 1
+	} else {
+		retryAfter = resetAt - now
+	}
+
+	var resetAfter int64
+	if count > 0 {
+		resetAfter = resetAt - now
+	}
+
+	return []int64{allowed, capacity - count, 0, retryAfter, resetAfter}, nil
+}
+
+// fixedWindowRefund is the Go function equivalent to luaFixedWindowRefund.
+func fixedWindowRefund(tx Tx, keys []string, args []int64) ([]int64, error) {
+	key := keys[0]
+	amount, now, resetAt := args[0], args[1], args[2]
+
+	value, ok, err := tx.Get(key)
+	if err != nil || !ok {
+		return []int64{0}, err
+	}
+	var count int64
+	if err := decodeState(value, &count); err != nil {
+		return nil, err
+	}
+	if count <= 0 {
+		return []int64{0}, nil
+	}
+
+	count = count - minInt64(amount, count)
+	ttl := time.Duration(ceilDiv(maxInt64(resetAt-now, 1), 1000)) * time.Millisecond
+	if err := tx.Set(key, encodeState(count), ttl); err != nil {
+		return nil, err
+	}
+	return []int64{1}, nil
+}
+
+var (
+	fixedWindowOp       = newOp("fixedwindow", luaFixedWindow, -1, fixedWindow)
+	fixedWindowRefundOp = newOp("fixedwindow.refund", luaFixedWindowRefund, -1, fixedWindowRefund)
+)
+
+// FixedWindow implements the Fixed Window Counter Algorithm, which allows
+// at most Capacity units in each window of length Interval.
+//
+// By default, the windows are aligned to the Unix epoch, thus to the wall
+// clock in UTC if Interval divides a day (e.g. a minute, an hour or a day).
+// If Location is set in the configuration, the windows are aligned to the
+// midnight of each day in Location instead, and never span midnight, which
+// makes calendar quotas like "1000 calls per day in Asia/Shanghai" possible.
+// An Interval of a day or longer then means the calendar day, however long
+// it lasts in Location.
+//
+// Note that a fixed window allows bursts of up to twice the capacity at
+// the window boundaries, see SlidingWindowCounter for an alternative.
+type FixedWindow struct {
+	baseBucket
+
+	store Store
+	key   string
+}
+
+// NewFixedWindow returns a new fixed-window rate limiter special for key
+// in redis with the specified configuration.
+func NewFixedWindow(redis Redis, key string, config *Config) *FixedWindow {
+	return NewFixedWindowWithStore(NewRedisStore(redis), key, config)
+}
+
+// NewFixedWindowWithStore returns a new fixed-window rate limiter special for key
+// in store with the specified configuration.
+func NewFixedWindowWithStore(store Store, key string, config *Config) *FixedWindow {
+	return &FixedWindow{
+		baseBucket: baseBucket{config: config},
+		store:      store,
+		key:        key,
+	}
+}
+
+// Allow implements Limiter by counting amount units in the current window.
+func (w *FixedWindow) Allow(ctx context.Context, amount int64) (Result, error) {
+	return w.prepare(amount).exec(ctx)
+}
+
+// prepare prepares the call for counting amount units in the current window.
+func (w *FixedWindow) prepare(amount int64) *call {
+	return w.prepareAt(amount, w.Clock().Now())
+}
+
+// prepareAt is like prepare, but counts the units in the window of now.
+func (w *FixedWindow) prepareAt(amount int64, now time.Time) *call {
+	config := w.Config()
+	if amount > config.Capacity {
+		return resolvedCall(newUnsatisfiableResult(config.Capacity))
+	}
+
+	start, end := window(now, config)
+	return &call{
+		store: w.store,
+		op:    fixedWindowOp,
+		keys:  []string{w.windowKey(start)},
+		args: []int64{
+			config.Capacity,
+			int64(time.Duration(now.UnixNano()) / time.Microsecond),
+			amount,
+			int64(time.Duration(end.UnixNano()) / time.Microsecond),
+		},
+		limit: config.Capacity,
+		now:   now,
+		// The window always resets at its end, even if nothing is counted in it.
+		resetAt: end,
+	}
+}
+
+// Wait implements Limiter by blocking until amount units can be counted in the current window.
+func (w *FixedWindow) Wait(ctx context.Context, amount int64) error {
+	return wait(ctx, w, amount)
+}
+
+// Reserve implements Limiter by counting amount units in the current window,
+// which will be taken out of the window if the reservation is cancelled.
+func (w *FixedWindow) Reserve(ctx context.Context, amount int64) (*Reservation, error) {
+	reserved := w.Clock().Now()
+	r, err := w.prepareAt(amount, reserved).exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	start, end := window(reserved, w.Config())
+	return newReservation(r, w.Clock(), func(ctx context.Context) error {
+		now := w.Clock().Now()
+		if !now.Before(end) {
+			return nil
+		}
+		_, err := w.store.Exec(
+			ctx,
+			fixedWindowRefundOp,
+			[]string{w.windowKey(start)},
+			amount,
+			int64(time.Duration(now.UnixNano())/time.Microsecond),
+			int64(time.Duration(end.UnixNano())/time.Microsecond),
+		)
+		return err
+	}), nil
+}
+
+// windowKey returns the key of the window starting at start.
+func (w *FixedWindow) windowKey(start time.Time) string {
+	return w.key + ":" + strconv.FormatInt(start.UnixNano()/int64(time.Millisecond), 10)
+}
+
+// window returns the start and the end of the fixed window containing t.
+func window(t time.Time, config Config) (start, end time.Time) {
+	interval := config.Interval
+	if config.Location == nil {
+		ns := t.UnixNano()
+		start = time.Unix(0, ns-ns%int64(interval))
+		return start, start.Add(interval)
+	}
+
+	t = t.In(config.Location)
+	year, month, day := t.Date()
+	midnight := time.Date(year, month, day, 0, 0, 0, 0, config.Location)
+	next := time.Date(year, month, day+1, 0, 0, 0, 0, config.Location)
+	if interval >= 24*time.Hour {
+		// A day lasts 23 or 25 hours across a DST transition, so the window
+		// is the calendar day rather than 24 hours from midnight.
+		return midnight, next
+	}
+
+	start = midnight.Add(t.Sub(midnight) / interval * interval)
+	end = start.Add(interval)
+	if end.After(next) {
+		end = next
+	}
+	return start, end
+}
@@ -0,0 +1,193 @@
+package ratelimiter_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RussellLuo/ratelimiter"
+	"github.com/go-redis/redis"
+)
+
+func TestFixedWindow_Allow(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	key := "ratelimiter:fixedwindow:test"
+	config := &ratelimiter.Config{
+		Interval: 1 * time.Second,
+		Capacity: 5,
+	}
+
+	// The fake clock starts at the beginning of a window.
+	clock := ratelimiter.NewFakeClock(time.Now().Truncate(config.Interval))
+
+	// moveTo moves the clock to the given offset into the next window.
+	moveTo := func(offset time.Duration) {
+		now := clock.Now()
+		clock.Set(now.Truncate(config.Interval).Add(config.Interval + offset))
+	}
+
+	stores := map[string]ratelimiter.Store{
+		"redis":  ratelimiter.NewRedisStore(&Redis{client}),
+		"memory": ratelimiter.NewMemory(ratelimiter.WithMemoryClock(clock)),
+	}
+	for name, store := range stores {
+		if keys := client.Keys(key + ":*").Val(); len(keys) > 0 {
+			client.Del(keys...)
+		}
+		window := ratelimiter.NewFixedWindowWithStore(store, key, config)
+		window.SetClock(clock)
+
+		cases := []struct {
+			offset time.Duration
+			amount int64
+			want   ratelimiter.Result
+		}{
+			{
+				offset: 0,
+				amount: 3,
+				want: ratelimiter.Result{
+					Allowed:    true,
+					Limit:      5,
+					Remaining:  2,
+					ResetAfter: 1 * time.Second,
+				},
+			},
+			{
+				offset: -1,
+				amount: 3,
+				want: ratelimiter.Result{
+					Allowed:    false,
+					Limit:      5,
+					Remaining:  2,
+					RetryAfter: 1 * time.Second,
+					ResetAfter: 1 * time.Second,
+				},
+			},
+			{
+				offset: -1,
+				amount: 2,
+				want: ratelimiter.Result{
+					Allowed:    true,
+					Limit:      5,
+					Remaining:  0,
+					ResetAfter: 1 * time.Second,
+				},
+			},
+			// The previous window is not counted at all.
+			{
+				offset: 500 * time.Millisecond,
+				amount: 5,
+				want: ratelimiter.Result{
+					Allowed:    true,
+					Limit:      5,
+					Remaining:  0,
+					ResetAfter: 500 * time.Millisecond,
+				},
+			},
+			{
+				offset: -1,
+				amount: 1,
+				want: ratelimiter.Result{
+					Allowed:    false,
+					Limit:      5,
+					Remaining:  0,
+					RetryAfter: 500 * time.Millisecond,
+					ResetAfter: 500 * time.Millisecond,
+				},
+			},
+		}
+		for _, c := range cases {
+			if c.offset >= 0 {
+				moveTo(c.offset)
+			}
+			got, err := window.Allow(context.Background(), c.amount)
+			if err != nil {
+				t.Fatalf("%s: Err: %v", name, err)
+			}
+			if !(got.Allowed == c.want.Allowed && got.Limit == c.want.Limit &&
+				got.Remaining == c.want.Remaining && got.RetryAfter == c.want.RetryAfter &&
+				got.ResetAfter == c.want.ResetAfter) {
+				t.Errorf("%s: Got (%#v) != Want (%#v)", name, got, c.want)
+			}
+		}
+	}
+}
+
+func TestFixedWindow_Location(t *testing.T) {
+	shanghai := time.FixedZone("UTC+8", 8*60*60)
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+
+	type call struct {
+		now     time.Time
+		allowed bool
+		resetAt time.Time
+	}
+	cases := []struct {
+		name     string
+		location *time.Location
+		interval time.Duration
+		calls    []call
+	}{
+		{
+			name:     "day",
+			location: shanghai,
+			interval: 24 * time.Hour,
+			calls: []call{
+				{now: time.Date(2026, 10, 18, 15, 30, 0, 0, shanghai), allowed: true, resetAt: time.Date(2026, 10, 19, 0, 0, 0, 0, shanghai)},
+			},
+		},
+		{
+			name:     "hour",
+			location: shanghai,
+			interval: time.Hour,
+			calls: []call{
+				{now: time.Date(2026, 10, 18, 15, 30, 0, 0, shanghai), allowed: true, resetAt: time.Date(2026, 10, 18, 16, 0, 0, 0, shanghai)},
+			},
+		},
+		{
+			// 2026-11-01 lasts 25 hours in New York, since the clocks are
+			// turned back from 02:00 EDT to 01:00 EST.
+			name:     "day across DST",
+			location: newYork,
+			interval: 24 * time.Hour,
+			calls: []call{
+				{now: time.Date(2026, 11, 1, 0, 30, 0, 0, newYork), allowed: true, resetAt: time.Date(2026, 11, 2, 0, 0, 0, 0, newYork)},
+				{now: time.Date(2026, 11, 1, 23, 30, 0, 0, newYork), allowed: false, resetAt: time.Date(2026, 11, 2, 0, 0, 0, 0, newYork)},
+				{now: time.Date(2026, 11, 2, 0, 30, 0, 0, newYork), allowed: true, resetAt: time.Date(2026, 11, 3, 0, 0, 0, 0, newYork)},
+			},
+		},
+		{
+			name:     "hour across DST",
+			location: newYork,
+			interval: time.Hour,
+			calls: []call{
+				{now: time.Date(2026, 11, 1, 23, 30, 0, 0, newYork), allowed: true, resetAt: time.Date(2026, 11, 2, 0, 0, 0, 0, newYork)},
+			},
+		},
+	}
+	for _, c := range cases {
+		clock := ratelimiter.NewFakeClock(c.calls[0].now)
+		window := ratelimiter.NewFixedWindowWithStore(ratelimiter.NewMemory(ratelimiter.WithMemoryClock(clock)), "key", &ratelimiter.Config{
+			Interval: c.interval,
+			Capacity: 1,
+			Location: c.location,
+		})
+		window.SetClock(clock)
+
+		for i, call := range c.calls {
+			clock.Set(call.now)
+			got, err := window.Allow(context.Background(), 1)
+			if err != nil {
+				t.Fatalf("%s #%d: Err: %v", c.name, i, err)
+			}
+			if got.Allowed != call.allowed || !got.ResetAt.Equal(call.resetAt) {
+				t.Errorf("%s #%d: Got (%v, %v) != Want (%v, %v)", c.name, i, got.Allowed, got.ResetAt, call.allowed, call.resetAt)
+			}
+		}
+	}
+}
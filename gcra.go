@@ -1,15 +1,16 @@
 package ratelimiter
 
 import (
+	"context"
 	"time"
 )
 
 // the Lua script that implements the generic cell rate algorithm.
-const luaGCRA = `
+const luaGCRA = luaClock + `
 local key = KEYS[1]
 local interval = tonumber(ARGV[1])
 local tolerance = tonumber(ARGV[2])
-local now = tonumber(ARGV[3])
+local now = clock(tonumber(ARGV[3]))
 local amount = tonumber(ARGV[4])
 
 local tat = redis.call("get", key)
@@ -20,32 +21,126 @@ else
 end
 
 local new_tat = math.max(now, tat) + amount
+local allow_at = new_tat - tolerance - interval
 
-if now >= new_tat - tolerance - interval then
-  local ttl = math.ceil((new_tat - now)/ 1000000)
-  if redis.call("setex", key, ttl, new_tat) then
-    return math.max(tat - now, 0)
-  end
+if now >= allow_at then
+  local ttl = math.ceil((new_tat - now) / 1000000)
+  redis.call("setex", key, ttl, string.format("%.f", new_tat))
+  local remaining = math.floor((now - allow_at) / interval)
+  return {1, remaining, math.max(tat - now, 0), 0, new_tat - now}
 end
 
-return -1
+local remaining = math.max(math.floor((now + tolerance + interval - math.max(now, tat)) / interval), 0)
+return {0, remaining, 0, allow_at - now, math.max(tat - now, 0)}
 `
 
+// the Lua script that rolls back the theoretical arrival time by amount,
+// without moving it into the past.
+const luaGCRARefund = luaClock + `
+local key = KEYS[1]
+local now = clock(tonumber(ARGV[1]))
+local amount = tonumber(ARGV[2])
+
+local tat = redis.call("get", key)
+if not tat then
+  return {0}
+end
+
+local new_tat = tonumber(tat) - amount
+if new_tat <= now then
+  redis.call("del", key)
+else
+  local ttl = math.ceil((new_tat - now) / 1000000)
+  redis.call("setex", key, ttl, string.format("%.f", new_tat))
+end
+return {1}
+`
+
+// gcra is the Go function equivalent to luaGCRA.
+func gcra(tx Tx, keys []string, args []int64) ([]int64, error) {
+	key := keys[0]
+	interval, tolerance, now, amount := args[0], args[1], args[2], args[3]
+
+	tat := now
+	value, ok, err := tx.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		if err := decodeState(value, &tat); err != nil {
+			return nil, err
+		}
+	}
+
+	newTAT := maxInt64(now, tat) + amount
+	allowAt := newTAT - tolerance - interval
+
+	if now >= allowAt {
+		ttl := ceilDiv(newTAT-now, 1000000)
+		if err := tx.Set(key, encodeState(newTAT), time.Duration(ttl)*time.Second); err != nil {
+			return nil, err
+		}
+		remaining := floorDiv(now-allowAt, interval)
+		return []int64{1, remaining, maxInt64(tat-now, 0), 0, newTAT - now}, nil
+	}
+
+	remaining := maxInt64(floorDiv(now+tolerance+interval-maxInt64(now, tat), interval), 0)
+	return []int64{0, remaining, 0, allowAt - now, maxInt64(tat-now, 0)}, nil
+}
+
+// gcraRefund is the Go function equivalent to luaGCRARefund.
+func gcraRefund(tx Tx, keys []string, args []int64) ([]int64, error) {
+	key := keys[0]
+	now, amount := args[0], args[1]
+
+	value, ok, err := tx.Get(key)
+	if err != nil || !ok {
+		return []int64{0}, err
+	}
+	var tat int64
+	if err := decodeState(value, &tat); err != nil {
+		return nil, err
+	}
+
+	newTAT := tat - amount
+	if newTAT <= now {
+		err = tx.Del(key)
+	} else {
+		ttl := ceilDiv(newTAT-now, 1000000)
+		err = tx.Set(key, encodeState(newTAT), time.Duration(ttl)*time.Second)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []int64{1}, nil
+}
+
+var (
+	gcraOp       = newOp("gcra", luaGCRA, 2, gcra)
+	gcraRefundOp = newOp("gcra.refund", luaGCRARefund, 0, gcraRefund)
+)
+
 // GCRA implements the generic cell rate algorithm.
 // See https://en.wikipedia.org/wiki/Generic_cell_rate_algorithm.
 type GCRA struct {
 	baseBucket
 
-	script *Script
-	key    string
+	store Store
+	key   string
 }
 
 // NewGCRA returns a new GCRA rate limiter special for key in redis
 // with the specified parameters.
 func NewGCRA(redis Redis, key string, config *Config) *GCRA {
+	return NewGCRAWithStore(NewRedisStore(redis), key, config)
+}
+
+// NewGCRAWithStore returns a new GCRA rate limiter special for key in store
+// with the specified parameters.
+func NewGCRAWithStore(store Store, key string, config *Config) *GCRA {
 	return &GCRA{
 		baseBucket: baseBucket{config: config},
-		script:     NewScript(redis, luaGCRA),
+		store:      store,
 		key:        key,
 	}
 }
@@ -54,9 +149,23 @@ func NewGCRA(redis Redis, key string, config *Config) *GCRA {
 // Think of count 1 represents a message containing only one cell, and
 // count greater than 1 represents a message containing multiple cells.
 func (g *GCRA) Transmit(amount int64) (bool, time.Duration, error) {
+	r, err := g.Allow(context.Background(), amount)
+	if !r.Allowed {
+		return false, -1, err
+	}
+	return true, r.Delay, nil
+}
+
+// Allow implements Limiter by transmitting a message of amount cells.
+func (g *GCRA) Allow(ctx context.Context, amount int64) (Result, error) {
+	return g.prepare(amount).exec(ctx)
+}
+
+// prepare prepares the call for transmitting amount cells.
+func (g *GCRA) prepare(amount int64) *call {
 	config := g.Config()
 	if amount > config.Capacity {
-		return false, -1, nil
+		return resolvedCall(newUnsatisfiableResult(config.Capacity))
 	}
 
 	// the interval between each arrival of one cell
@@ -64,22 +173,51 @@ func (g *GCRA) Transmit(amount int64) (bool, time.Duration, error) {
 	// how much earlier a cell can arrive than it would
 	delayVariationTolerance := time.Duration(config.Capacity-1) * config.Interval
 
-	now := time.Now().UnixNano()
-	result, err := g.script.Run(
+	now := g.Clock().Now()
+	return &call{
+		store: g.store,
+		op:    gcraOp,
+		keys:  []string{g.key},
+		args: []int64{
+			int64(emissionInterval / time.Microsecond),
+			int64(delayVariationTolerance / time.Microsecond),
+			int64(time.Duration(now.UnixNano()) / time.Microsecond),
+			amount * int64(emissionInterval/time.Microsecond),
+		},
+		limit: config.Capacity,
+		now:   now,
+	}
+}
+
+// Wait implements Limiter by transmitting a message of amount cells
+// and blocking until it conforms.
+func (g *GCRA) Wait(ctx context.Context, amount int64) error {
+	return wait(ctx, g, amount)
+}
+
+// Reserve implements Limiter by transmitting a message of amount cells,
+// whose effect on the theoretical arrival time will be rolled back if
+// the reservation is cancelled.
+func (g *GCRA) Reserve(ctx context.Context, amount int64) (*Reservation, error) {
+	r, err := g.Allow(ctx, amount)
+	if err != nil {
+		return nil, err
+	}
+	return newReservation(r, g.Clock(), func(ctx context.Context) error {
+		return g.refund(ctx, amount)
+	}), nil
+}
+
+// refund rolls back the theoretical arrival time by amount cells.
+func (g *GCRA) refund(ctx context.Context, amount int64) error {
+	config := g.Config()
+	now := g.Clock().Now().UnixNano()
+	_, err := g.store.Exec(
+		ctx,
+		gcraRefundOp,
 		[]string{g.key},
-		int64(emissionInterval/time.Microsecond),
-		int64(delayVariationTolerance/time.Microsecond),
 		int64(time.Duration(now)/time.Microsecond),
-		amount*int64(emissionInterval/time.Microsecond),
+		amount*int64(config.Interval/time.Microsecond),
 	)
-	if err != nil {
-		return false, -1, err
-	} else {
-		switch delayed := result.(int64); delayed {
-		case -1:
-			return false, -1, nil
-		default:
-			return true, time.Duration(delayed) * time.Microsecond, nil
-		}
-	}
+	return err
 }
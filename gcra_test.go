@@ -1,6 +1,7 @@
 package ratelimiter_test
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -22,6 +23,8 @@ func TestGCRA_Transmit(t *testing.T) {
 			Capacity: 5,
 		},
 	)
+	clock := ratelimiter.NewFakeClock(time.Now())
+	gcra.SetClock(clock)
 
 	cases := []struct {
 		in   []arg
@@ -169,9 +172,83 @@ func TestGCRA_Transmit(t *testing.T) {
 	}
 	for _, c := range cases {
 		client.Del(key)
-		got := concurrentlyDo(gcra.Transmit, c.in)
+		got := concurrentlyDo(clock, gcra.Transmit, c.in)
 		if !deepEqual(got, c.want, true) {
 			t.Errorf("Got (%#v) != Want (%#v)", got, c.want)
 		}
 	}
 }
+
+func TestGCRA_Allow(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	key := "ratelimiter:gcra:test"
+
+	gcra := ratelimiter.NewGCRA(
+		&Redis{client},
+		key,
+		&ratelimiter.Config{
+			Interval: 1 * time.Second / 2,
+			Capacity: 5,
+		},
+	)
+	clock := ratelimiter.NewFakeClock(time.Now())
+	gcra.SetClock(clock)
+
+	client.Del(key)
+	cases := []struct {
+		amount int64
+		want   ratelimiter.Result
+	}{
+		{
+			amount: 3,
+			want: ratelimiter.Result{
+				Allowed:    true,
+				Limit:      5,
+				Remaining:  2,
+				ResetAfter: 1500 * time.Millisecond,
+			},
+		},
+		{
+			amount: 3,
+			want: ratelimiter.Result{
+				Allowed:    false,
+				Limit:      5,
+				Remaining:  2,
+				RetryAfter: 500 * time.Millisecond,
+				ResetAfter: 1500 * time.Millisecond,
+			},
+		},
+		{
+			amount: 2,
+			want: ratelimiter.Result{
+				Allowed:    true,
+				Limit:      5,
+				Remaining:  0,
+				Delay:      1500 * time.Millisecond,
+				ResetAfter: 2500 * time.Millisecond,
+			},
+		},
+		{
+			amount: 6,
+			want: ratelimiter.Result{
+				Allowed:    false,
+				Limit:      5,
+				Remaining:  0,
+				RetryAfter: -1,
+			},
+		},
+	}
+	for _, c := range cases {
+		got, err := gcra.Allow(context.Background(), c.amount)
+		if err != nil {
+			t.Fatalf("Err: %v", err)
+		}
+		if !(got.Allowed == c.want.Allowed && got.Limit == c.want.Limit &&
+			got.Remaining == c.want.Remaining && got.Delay == c.want.Delay &&
+			got.RetryAfter == c.want.RetryAfter && got.ResetAfter == c.want.ResetAfter) {
+			t.Errorf("Got (%#v) != Want (%#v)", got, c.want)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package goredis_test
+
+import (
+	"time"
+
+	"github.com/RussellLuo/ratelimiter"
+	"github.com/RussellLuo/ratelimiter/goredis"
+	"github.com/redis/go-redis/v9"
+)
+
+func ExampleNew() {
+	client := redis.NewClusterClient(&redis.ClusterOptions{
+		Addrs: []string{"localhost:7000", "localhost:7001", "localhost:7002"},
+	})
+	store := ratelimiter.NewRedisStore(goredis.New(client), ratelimiter.WithCluster())
+
+	bucket := ratelimiter.NewTokenBucketWithStore(store, ratelimiter.HashTag("user:42"), &ratelimiter.Config{
+		Interval: 1 * time.Second / 10,
+		Capacity: 20,
+	})
+	_ = bucket
+}
@@ -0,0 +1,83 @@
+// Package goredis adapts the clients of go-redis v9 to the Redis interface
+// of package ratelimiter.
+package goredis
+
+import (
+	"context"
+	"errors"
+
+	"github.com/RussellLuo/ratelimiter"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	_ ratelimiter.ContextRedis = (*Redis)(nil)
+	_ ratelimiter.ScriptLoader = (*Redis)(nil)
+)
+
+// Redis implements ratelimiter.Redis on top of a client of go-redis v9,
+// which may be a *redis.Client, a *redis.ClusterClient or a *redis.Ring.
+type Redis struct {
+	client redis.Scripter
+}
+
+// New returns a new adapter of client.
+func New(client redis.Scripter) *Redis {
+	return &Redis{client: client}
+}
+
+// Eval runs the Lua script src.
+func (r *Redis) Eval(src string, keys []string, args ...interface{}) (interface{}, error) {
+	return r.EvalContext(context.Background(), src, keys, args...)
+}
+
+// EvalSha runs the Lua script cached by its SHA1 digest. The returned bool
+// reports whether the script is not cached, i.e. the error is NOSCRIPT.
+func (r *Redis) EvalSha(sha1 string, keys []string, args ...interface{}) (interface{}, error, bool) {
+	return r.EvalShaContext(context.Background(), sha1, keys, args...)
+}
+
+// EvalContext is like Eval but honors the cancellation and deadline of ctx.
+func (r *Redis) EvalContext(ctx context.Context, src string, keys []string, args ...interface{}) (interface{}, error) {
+	return reply(r.client.Eval(ctx, src, keys, args...).Result())
+}
+
+// EvalShaContext is like EvalSha but honors the cancellation and deadline of ctx.
+func (r *Redis) EvalShaContext(ctx context.Context, sha1 string, keys []string, args ...interface{}) (interface{}, error, bool) {
+	result, err := reply(r.client.EvalSha(ctx, sha1, keys, args...).Result())
+	return result, err, redis.HasErrorPrefix(err, "NOSCRIPT")
+}
+
+// ScriptLoad loads the Lua script src, which is loaded on every master
+// of a *redis.ClusterClient, and on every shard of a *redis.Ring.
+func (r *Redis) ScriptLoad(src string) (string, error) {
+	return r.client.ScriptLoad(context.Background(), src).Result()
+}
+
+// reply converts the result of a script into the types expected by package
+// ratelimiter, i.e. int64 for integers and []interface{} for arrays.
+func reply(result interface{}, err error) (interface{}, error) {
+	if errors.Is(err, redis.Nil) {
+		// The script returned nil.
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return convert(result), nil
+}
+
+func convert(v interface{}) interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		for i, e := range v {
+			values[i] = convert(e)
+		}
+		return values
+	case int:
+		return int64(v)
+	default:
+		return v
+	}
+}
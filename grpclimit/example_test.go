@@ -0,0 +1,29 @@
+package grpclimit_test
+
+import (
+	"time"
+
+	"github.com/RussellLuo/ratelimiter"
+	"github.com/RussellLuo/ratelimiter/grpclimit"
+	"google.golang.org/grpc"
+)
+
+func ExampleUnaryServerInterceptor() {
+	limiter := ratelimiter.NewKeyedLimiterWithStore(
+		ratelimiter.NewMemory(),
+		"grpc",
+		ratelimiter.AlgorithmGCRA,
+		&ratelimiter.Config{
+			Interval: 1 * time.Second / 10,
+			Capacity: 20,
+		},
+	)
+
+	// Limit each peer on each method.
+	keyFunc := grpclimit.Compose(grpclimit.FullMethod(), grpclimit.Peer())
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(grpclimit.UnaryServerInterceptor(limiter, keyFunc)),
+		grpc.StreamInterceptor(grpclimit.StreamServerInterceptor(limiter, keyFunc)),
+	)
+	defer server.Stop()
+}
@@ -0,0 +1,166 @@
+// Package grpclimit provides gRPC server interceptors that rate-limit the
+// calls by any of the limiters in package ratelimiter.
+package grpclimit
+
+import (
+	"context"
+	"errors"
+
+	"github.com/RussellLuo/ratelimiter"
+	"github.com/RussellLuo/ratelimiter/internal/keyed"
+	"github.com/RussellLuo/ratelimiter/internal/timer"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Limiter is the keyed rate limiter consulted by the interceptors, which is
+// implemented by *ratelimiter.KeyedLimiter.
+type Limiter = keyed.Limiter
+
+// LimiterFunc is an adapter to allow the use of an ordinary function as
+// a Limiter, e.g. LimiterFunc(quota.Consume) for a *ratelimiter.Quota.
+type LimiterFunc = keyed.LimiterFunc
+
+// Single returns a Limiter that limits all the keys together by l,
+// e.g. for a global limit of a service.
+func Single(l ratelimiter.Limiter) Limiter {
+	return keyed.Single(l)
+}
+
+// Option is an option for configuring the interceptors.
+type Option func(*options)
+
+type options struct {
+	onError        func(ctx context.Context, err error) error
+	messageLimiter Limiter
+}
+
+// WithErrorHandler sets the function that converts the error, which occurs
+// if the key cannot be extracted or the limiter fails, into the error
+// returned to the client. Returning nil lets the call through.
+//
+// By default, the error is InvalidArgument for ErrNoKey, and Internal for
+// any other error.
+func WithErrorHandler(f func(ctx context.Context, err error) error) Option {
+	return func(o *options) {
+		o.onError = f
+	}
+}
+
+// WithMessageLimiter sets the limiter that meters each message received on
+// a stream, under the same key as the stream. It should be separate from
+// the limiter of the stream opens, so that a long-lived stream does not use
+// up the budget of the calls. By default, the messages are not metered.
+func WithMessageLimiter(l Limiter) Option {
+	return func(o *options) {
+		o.messageLimiter = l
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{onError: defaultError}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// UnaryServerInterceptor returns a unary server interceptor that rate-limits
+// each call by limiter under the key extracted by keyFunc. The calls denied
+// fail with ResourceExhausted, whose details include a RetryInfo.
+func UnaryServerInterceptor(limiter Limiter, keyFunc KeyFunc, opts ...Option) grpc.UnaryServerInterceptor {
+	o := newOptions(opts)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		key, err := keyFunc(ctx, info.FullMethod)
+		if err != nil {
+			if err := o.onError(ctx, err); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}
+		if err := o.admit(ctx, limiter, key); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns a stream server interceptor that
+// rate-limits each stream open by limiter under the key extracted by
+// keyFunc, as well as each message received on the stream if
+// WithMessageLimiter is set. The streams or messages denied fail with
+// ResourceExhausted, whose details include a RetryInfo.
+func StreamServerInterceptor(limiter Limiter, keyFunc KeyFunc, opts ...Option) grpc.StreamServerInterceptor {
+	o := newOptions(opts)
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		key, err := keyFunc(ss.Context(), info.FullMethod)
+		if err != nil {
+			if err := o.onError(ss.Context(), err); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		}
+		if err := o.admit(ss.Context(), limiter, key); err != nil {
+			return err
+		}
+		if o.messageLimiter != nil {
+			ss = &meteredStream{ServerStream: ss, options: o, key: key}
+		}
+		return handler(srv, ss)
+	}
+}
+
+// meteredStream meters each message received by the message limiter.
+type meteredStream struct {
+	grpc.ServerStream
+
+	options *options
+	key     string
+}
+
+func (s *meteredStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return s.options.admit(s.Context(), s.options.messageLimiter, s.key)
+}
+
+// admit consults limiter for one unit under key, and returns the error
+// to fail the call with if it is not allowed.
+func (o *options) admit(ctx context.Context, limiter Limiter, key string) error {
+	result, err := limiter.Allow(ctx, key, 1)
+	if err != nil {
+		return o.onError(ctx, err)
+	}
+	if !result.Allowed {
+		return exhausted(result)
+	}
+	if err := timer.Sleep(ctx, result.Delay); err != nil {
+		return status.FromContextError(err).Err()
+	}
+	return nil
+}
+
+// exhausted returns the ResourceExhausted error for the denied result.
+func exhausted(result ratelimiter.Result) error {
+	st := status.New(codes.ResourceExhausted, "rate limit exceeded")
+	if result.RetryAfter < 0 {
+		return st.Err()
+	}
+	if detailed, err := st.WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(result.RetryAfter),
+	}); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+func defaultError(ctx context.Context, err error) error {
+	if errors.Is(err, ErrNoKey) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
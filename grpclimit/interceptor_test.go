@@ -0,0 +1,134 @@
+package grpclimit_test
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/RussellLuo/ratelimiter"
+	"github.com/RussellLuo/ratelimiter/grpclimit"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func newLimiter(capacity int64) *ratelimiter.KeyedLimiter {
+	return ratelimiter.NewKeyedLimiterWithStore(
+		ratelimiter.NewMemory(),
+		"test",
+		ratelimiter.AlgorithmTokenBucket,
+		&ratelimiter.Config{
+			Interval: 10 * time.Second,
+			Capacity: capacity,
+		},
+	)
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	interceptor := grpclimit.UnaryServerInterceptor(newLimiter(1), grpclimit.Metadata("x-api-key"))
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "OK", nil
+	}
+
+	call := func(apiKey string) error {
+		ctx := context.Background()
+		if apiKey != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("x-api-key", apiKey))
+		}
+		_, err := interceptor(ctx, nil, info, handler)
+		return err
+	}
+
+	if err := call("alice"); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+
+	st := status.Convert(call("alice"))
+	if st.Code() != codes.ResourceExhausted {
+		t.Fatalf("Got (%v) != Want (%v)", st.Code(), codes.ResourceExhausted)
+	}
+	var retryDelay time.Duration
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.RetryInfo); ok {
+			retryDelay = info.RetryDelay.AsDuration()
+		}
+	}
+	if retryDelay <= 9*time.Second || retryDelay > 10*time.Second {
+		t.Errorf("Got RetryDelay (%v) != Want (~10s)", retryDelay)
+	}
+
+	if err := call("bob"); err != nil {
+		t.Errorf("Err: %v", err)
+	}
+	if code := status.Code(call("")); code != codes.InvalidArgument {
+		t.Errorf("Got (%v) != Want (%v)", code, codes.InvalidArgument)
+	}
+}
+
+// fakeStream is a grpc.ServerStream that receives n messages.
+type fakeStream struct {
+	grpc.ServerStream
+	n int
+}
+
+func (s *fakeStream) Context() context.Context {
+	return context.Background()
+}
+
+func (s *fakeStream) RecvMsg(m interface{}) error {
+	if s.n == 0 {
+		return io.EOF
+	}
+	s.n--
+	return nil
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	info := &grpc.StreamServerInfo{FullMethod: "/test.Service/Stream"}
+	handler := func(srv interface{}, ss grpc.ServerStream) error {
+		for {
+			if err := ss.RecvMsg(nil); err != nil {
+				if err == io.EOF {
+					return nil
+				}
+				return err
+			}
+		}
+	}
+
+	cases := []struct {
+		name     string
+		opts     []grpclimit.Option
+		messages int
+		want     codes.Code
+	}{
+		{
+			name:     "messages not metered",
+			messages: 5,
+			want:     codes.OK,
+		},
+		{
+			name:     "messages within the limit",
+			opts:     []grpclimit.Option{grpclimit.WithMessageLimiter(newLimiter(3))},
+			messages: 3,
+			want:     codes.OK,
+		},
+		{
+			name:     "messages beyond the limit",
+			opts:     []grpclimit.Option{grpclimit.WithMessageLimiter(newLimiter(3))},
+			messages: 4,
+			want:     codes.ResourceExhausted,
+		},
+	}
+	for _, c := range cases {
+		interceptor := grpclimit.StreamServerInterceptor(newLimiter(1), grpclimit.FullMethod(), c.opts...)
+		err := interceptor(nil, &fakeStream{n: c.messages}, info, handler)
+		if code := status.Code(err); code != c.want {
+			t.Errorf("%s: Got (%v) != Want (%v)", c.name, code, c.want)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package grpclimit
+
+import (
+	"context"
+	"net"
+
+	"github.com/RussellLuo/ratelimiter/internal/keyed"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// ErrNoKey is returned by a KeyFunc if the call carries no key.
+var ErrNoKey = keyed.ErrNoKey
+
+// KeyFunc extracts the rate-limiting key from a call to fullMethod.
+type KeyFunc func(ctx context.Context, fullMethod string) (string, error)
+
+// FullMethod returns a KeyFunc that extracts the full method name,
+// e.g. "/package.Service/Method", which limits each method as a whole.
+func FullMethod() KeyFunc {
+	return func(ctx context.Context, fullMethod string) (string, error) {
+		return fullMethod, nil
+	}
+}
+
+// Metadata returns a KeyFunc that extracts the first value of the
+// incoming metadata key name, e.g. "x-api-key".
+func Metadata(name string) KeyFunc {
+	return func(ctx context.Context, fullMethod string) (string, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if values := md.Get(name); len(values) > 0 && values[0] != "" {
+			return values[0], nil
+		}
+		return "", ErrNoKey
+	}
+}
+
+// Peer returns a KeyFunc that extracts the address of the peer, without
+// the port if it is an IP address.
+func Peer() KeyFunc {
+	return func(ctx context.Context, fullMethod string) (string, error) {
+		p, ok := peer.FromContext(ctx)
+		if !ok || p.Addr == nil {
+			return "", ErrNoKey
+		}
+		addr := p.Addr.String()
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			return host, nil
+		}
+		return addr, nil
+	}
+}
+
+// Compose returns a KeyFunc that joins the keys extracted by funcs with
+// ":", e.g. Compose(FullMethod(), Peer()) for limiting each peer on each
+// method.
+func Compose(funcs ...KeyFunc) KeyFunc {
+	return func(ctx context.Context, fullMethod string) (string, error) {
+		return keyed.Compose(len(funcs), func(i int) (string, error) {
+			return funcs[i](ctx, fullMethod)
+		})
+	}
+}
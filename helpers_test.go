@@ -1,12 +1,39 @@
 package ratelimiter_test
 
 import (
+	"context"
 	"sort"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/RussellLuo/ratelimiter"
+	"github.com/go-redis/redis"
 )
 
-const delayedError = 6 * time.Millisecond
+// Redis adapts the go-redis v6 client used by the tests, which predates
+// the adapters in the subpackages, to ratelimiter.Redis.
+type Redis struct {
+	client *redis.Client
+}
+
+func (r *Redis) Eval(script string, keys []string, args ...interface{}) (interface{}, error) {
+	return r.EvalContext(context.Background(), script, keys, args...)
+}
+
+func (r *Redis) EvalSha(sha1 string, keys []string, args ...interface{}) (interface{}, error, bool) {
+	return r.EvalShaContext(context.Background(), sha1, keys, args...)
+}
+
+func (r *Redis) EvalContext(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	return r.client.WithContext(ctx).Eval(script, keys, args...).Result()
+}
+
+func (r *Redis) EvalShaContext(ctx context.Context, sha1 string, keys []string, args ...interface{}) (interface{}, error, bool) {
+	result, err := r.client.WithContext(ctx).EvalSha(sha1, keys, args...).Result()
+	noScript := err != nil && strings.HasPrefix(err.Error(), "NOSCRIPT ")
+	return result, err, noScript
+}
 
 type Func func(int64) (bool, time.Duration, error)
 
@@ -29,24 +56,29 @@ type result struct {
 	DelayDurations []time.Duration
 }
 
-func concurrentlyDo(f Func, args []arg) []result {
+// concurrentlyDo calls f concurrently for each arg, once clock has been
+// moved forward by WaitDuration since the start. The args must be sorted
+// by WaitDuration in ascending order.
+func concurrentlyDo(clock *ratelimiter.FakeClock, f Func, args []arg) []result {
 	times := len(args)
 	rvChans := make([]chan rv, times)
 
-	var wg sync.WaitGroup
+	start := clock.Now()
 	for i, a := range args {
+		clock.Set(start.Add(a.WaitDuration))
+
+		var wg sync.WaitGroup
 		rvChans[i] = make(chan rv, a.Concurrency)
 		for j := 0; j < a.Concurrency; j++ {
 			wg.Add(1)
 			go func(i int, a arg) {
-				time.Sleep(a.WaitDuration)
 				ok, delayed, err := f(a.Amount)
 				rvChans[i] <- rv{ok: ok, delayed: delayed, err: err}
 				wg.Done()
 			}(i, a)
 		}
+		wg.Wait()
 	}
-	wg.Wait()
 
 	for _, c := range rvChans {
 		close(c)
@@ -56,7 +88,7 @@ func concurrentlyDo(f Func, args []arg) []result {
 	for i, c := range rvChans {
 		for rv := range c {
 			if rv.ok {
-				if rv.delayed < delayedError {
+				if rv.delayed == 0 {
 					result[i].Passed++
 				} else {
 					result[i].Delayed++
@@ -85,8 +117,7 @@ func deepEqual(got []result, want []result, careDelayed bool) bool {
 		}
 		if careDelayed {
 			for j, d := range r.DelayDurations {
-				wantD := want[i].DelayDurations[j]
-				if !(d > wantD-delayedError && d < wantD+delayedError) {
+				if d != want[i].DelayDurations[j] {
 					return false
 				}
 			}
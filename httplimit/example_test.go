@@ -0,0 +1,30 @@
+package httplimit_test
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/RussellLuo/ratelimiter"
+	"github.com/RussellLuo/ratelimiter/httplimit"
+)
+
+func ExampleNew() {
+	limiter := ratelimiter.NewKeyedLimiterWithStore(
+		ratelimiter.NewMemory(),
+		"http",
+		ratelimiter.AlgorithmGCRA,
+		&ratelimiter.Config{
+			Interval: 1 * time.Second / 10,
+			Capacity: 20,
+		},
+	)
+
+	// Limit each client by its IP address, behind a load balancer in 10.0.0.0/8.
+	_, lb, _ := net.ParseCIDR("10.0.0.0/8")
+	middleware := httplimit.New(limiter, httplimit.RemoteIP(lb))
+
+	http.Handle("/", middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello"))
+	})))
+}
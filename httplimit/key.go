@@ -0,0 +1,142 @@
+package httplimit
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/RussellLuo/ratelimiter/internal/keyed"
+)
+
+// ErrNoKey is returned by a KeyFunc if the request carries no key.
+var ErrNoKey = keyed.ErrNoKey
+
+// KeyFunc extracts the rate-limiting key from a request.
+type KeyFunc func(r *http.Request) (string, error)
+
+// RemoteIP returns a KeyFunc that extracts the IP address of the client.
+//
+// If the request comes from one of trustedProxies, the X-Forwarded-For
+// header is walked from right to left, and the first address that is not
+// a trusted proxy is taken as the client, which cannot be spoofed by the
+// client as long as all the proxies in between are trusted. Otherwise,
+// the header is ignored, and the address of the peer is used.
+func RemoteIP(trustedProxies ...*net.IPNet) KeyFunc {
+	trusted := func(ip net.IP) bool {
+		for _, n := range trustedProxies {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(r *http.Request) (string, error) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		ip := net.ParseIP(host)
+		if ip == nil {
+			return "", ErrNoKey
+		}
+
+		if trusted(ip) {
+			forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+			for i := len(forwarded) - 1; i >= 0; i-- {
+				hop := net.ParseIP(strings.TrimSpace(forwarded[i]))
+				if hop == nil {
+					break
+				}
+				ip = hop
+				if !trusted(hop) {
+					break
+				}
+			}
+		}
+		return ip.String(), nil
+	}
+}
+
+// Host returns a KeyFunc that extracts the host of the request URL, which
+// is useful for throttling the outgoing requests per upstream (see Transport).
+func Host() KeyFunc {
+	return func(r *http.Request) (string, error) {
+		if r.URL != nil && r.URL.Host != "" {
+			return r.URL.Host, nil
+		}
+		if r.Host != "" {
+			return r.Host, nil
+		}
+		return "", ErrNoKey
+	}
+}
+
+// Header returns a KeyFunc that extracts the value of the header name.
+func Header(name string) KeyFunc {
+	return func(r *http.Request) (string, error) {
+		if v := r.Header.Get(name); v != "" {
+			return v, nil
+		}
+		return "", ErrNoKey
+	}
+}
+
+// APIKey returns a KeyFunc that extracts the API key from the header name,
+// or from the query parameter param if the header is absent. Either can be
+// empty to disable it.
+func APIKey(name, param string) KeyFunc {
+	return func(r *http.Request) (string, error) {
+		if name != "" {
+			if v := r.Header.Get(name); v != "" {
+				return v, nil
+			}
+		}
+		if param != "" {
+			if v := r.URL.Query().Get(param); v != "" {
+				return v, nil
+			}
+		}
+		return "", ErrNoKey
+	}
+}
+
+// Route returns a KeyFunc that always returns the route pattern, which
+// limits all the requests to the route as a whole when the middleware
+// wraps the handler of the route, e.g. Route("GET /users/{id}").
+func Route(pattern string) KeyFunc {
+	return func(r *http.Request) (string, error) {
+		return pattern, nil
+	}
+}
+
+// User returns a KeyFunc that extracts the authenticated user, which is
+// stored in the request context under contextKey by an authentication
+// middleware, as a string or a fmt.Stringer.
+func User(contextKey interface{}) KeyFunc {
+	return func(r *http.Request) (string, error) {
+		switch v := r.Context().Value(contextKey).(type) {
+		case string:
+			if v != "" {
+				return v, nil
+			}
+		case fmt.Stringer:
+			if s := v.String(); s != "" {
+				return s, nil
+			}
+		}
+		return "", ErrNoKey
+	}
+}
+
+// Compose returns a KeyFunc that joins the keys extracted by funcs with
+// ":", e.g. Compose(Route("POST /login"), RemoteIP()) for limiting each
+// client on a route.
+func Compose(funcs ...KeyFunc) KeyFunc {
+	return func(r *http.Request) (string, error) {
+		return keyed.Compose(len(funcs), func(i int) (string, error) {
+			return funcs[i](r)
+		})
+	}
+}
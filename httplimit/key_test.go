@@ -0,0 +1,84 @@
+package httplimit_test
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RussellLuo/ratelimiter/httplimit"
+)
+
+func TestRemoteIP(t *testing.T) {
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+
+	cases := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{
+			name:       "direct",
+			remoteAddr: "203.0.113.1:1234",
+			want:       "203.0.113.1",
+		},
+		{
+			name:       "spoofed by an untrusted peer",
+			remoteAddr: "203.0.113.1:1234",
+			forwarded:  []string{"198.51.100.1"},
+			want:       "203.0.113.1",
+		},
+		{
+			name:       "behind trusted proxies",
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  []string{"198.51.100.1, 203.0.113.1", "10.0.0.2"},
+			want:       "203.0.113.1",
+		},
+		{
+			name:       "behind trusted proxies only",
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  []string{"10.0.0.3, 10.0.0.2"},
+			want:       "10.0.0.3",
+		},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = c.remoteAddr
+		for _, v := range c.forwarded {
+			r.Header.Add("X-Forwarded-For", v)
+		}
+
+		got, err := httplimit.RemoteIP(proxies)(r)
+		if err != nil {
+			t.Fatalf("%s: Err: %v", c.name, err)
+		}
+		if got != c.want {
+			t.Errorf("%s: Got (%s) != Want (%s)", c.name, got, c.want)
+		}
+	}
+}
+
+func TestCompose(t *testing.T) {
+	type userKey struct{}
+
+	r := httptest.NewRequest("GET", "/?api_key=secret", nil)
+	r = r.WithContext(context.WithValue(r.Context(), userKey{}, "alice"))
+
+	keyFunc := httplimit.Compose(
+		httplimit.Route("GET /"),
+		httplimit.User(userKey{}),
+		httplimit.APIKey("X-API-Key", "api_key"),
+	)
+	got, err := keyFunc(r)
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if want := "GET /:alice:secret"; got != want {
+		t.Errorf("Got (%s) != Want (%s)", got, want)
+	}
+
+	if _, err := httplimit.Compose(httplimit.Header("X-Missing"))(r); err != httplimit.ErrNoKey {
+		t.Errorf("Got (%v) != Want (%v)", err, httplimit.ErrNoKey)
+	}
+}
@@ -0,0 +1,154 @@
+// Package httplimit provides a net/http middleware that rate-limits the
+// requests by any of the limiters in package ratelimiter.
+package httplimit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/RussellLuo/ratelimiter"
+	"github.com/RussellLuo/ratelimiter/internal/keyed"
+	"github.com/RussellLuo/ratelimiter/internal/timer"
+)
+
+// Limiter is the keyed rate limiter consulted by the middleware, which is
+// implemented by *ratelimiter.KeyedLimiter.
+type Limiter = keyed.Limiter
+
+// LimiterFunc is an adapter to allow the use of an ordinary function as
+// a Limiter, e.g. LimiterFunc(quota.Consume) for a *ratelimiter.Quota.
+type LimiterFunc = keyed.LimiterFunc
+
+// Single returns a Limiter that limits all the keys together by l,
+// e.g. for a global limit of a service.
+func Single(l ratelimiter.Limiter) Limiter {
+	return keyed.Single(l)
+}
+
+// Option is an option for configuring the middleware.
+type Option func(*options)
+
+type options struct {
+	denied  http.Handler
+	onError func(w http.ResponseWriter, r *http.Request, err error)
+	cost    func(r *http.Request) int64
+}
+
+// WithDeniedHandler sets the handler that writes the response for the
+// requests denied by the limiter, after the rate-limiting headers have
+// been set. The result of the limiter is available by ResultFromContext.
+//
+// By default, the response is 429 Too Many Requests with a plain text body.
+func WithDeniedHandler(h http.Handler) Option {
+	return func(o *options) {
+		o.denied = h
+	}
+}
+
+// WithErrorHandler sets the function that writes the response if the
+// key cannot be extracted, or the limiter fails.
+//
+// By default, the response is 400 Bad Request for ErrNoKey, and
+// 500 Internal Server Error for any other error.
+func WithErrorHandler(f func(w http.ResponseWriter, r *http.Request, err error)) Option {
+	return func(o *options) {
+		o.onError = f
+	}
+}
+
+// WithCost sets the function that returns the amount of units each
+// request costs, which is 1 by default.
+func WithCost(f func(r *http.Request) int64) Option {
+	return func(o *options) {
+		o.cost = f
+	}
+}
+
+// New returns a middleware that rate-limits each request by limiter under
+// the key extracted by keyFunc.
+//
+// Each response carries the RateLimit-Limit, RateLimit-Remaining and
+// RateLimit-Reset headers, and the Retry-After header is added to the
+// denied ones. If the limiter allows a request with a delay (e.g. the
+// leaky bucket), the request is held for the delay before being served.
+func New(limiter Limiter, keyFunc KeyFunc, opts ...Option) func(http.Handler) http.Handler {
+	o := &options{
+		denied:  http.HandlerFunc(defaultDenied),
+		onError: defaultError,
+		cost: func(*http.Request) int64 {
+			return 1
+		},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, err := keyFunc(r)
+			if err != nil {
+				o.onError(w, r, err)
+				return
+			}
+
+			result, err := limiter.Allow(r.Context(), key, o.cost(r))
+			if err != nil {
+				o.onError(w, r, err)
+				return
+			}
+
+			setHeaders(w.Header(), result)
+			r = r.WithContext(context.WithValue(r.Context(), resultKey{}, result))
+
+			if !result.Allowed {
+				o.denied.ServeHTTP(w, r)
+				return
+			}
+			if err := timer.Sleep(r.Context(), result.Delay); err != nil {
+				// The client has gone away.
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type resultKey struct{}
+
+// ResultFromContext returns the result of the limiter for the request,
+// whose context is passed to the handlers after the middleware.
+func ResultFromContext(ctx context.Context) (ratelimiter.Result, bool) {
+	result, ok := ctx.Value(resultKey{}).(ratelimiter.Result)
+	return result, ok
+}
+
+// setHeaders sets the rate-limiting headers by result, whose durations
+// are rounded up to seconds.
+func setHeaders(h http.Header, result ratelimiter.Result) {
+	h.Set("RateLimit-Limit", strconv.FormatInt(result.Limit, 10))
+	h.Set("RateLimit-Remaining", strconv.FormatInt(result.Remaining, 10))
+	h.Set("RateLimit-Reset", strconv.FormatInt(seconds(result.ResetAfter), 10))
+	if !result.Allowed && result.RetryAfter >= 0 {
+		h.Set("Retry-After", strconv.FormatInt(seconds(result.RetryAfter), 10))
+	}
+}
+
+func seconds(d time.Duration) int64 {
+	return int64(math.Ceil(d.Seconds()))
+}
+
+func defaultDenied(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+}
+
+func defaultError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, ErrNoKey) {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
@@ -0,0 +1,101 @@
+package httplimit_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RussellLuo/ratelimiter"
+	"github.com/RussellLuo/ratelimiter/httplimit"
+)
+
+func TestNew(t *testing.T) {
+	limiter := ratelimiter.NewKeyedLimiterWithStore(
+		ratelimiter.NewMemory(),
+		"test",
+		ratelimiter.AlgorithmTokenBucket,
+		&ratelimiter.Config{
+			Interval: 10 * time.Second,
+			Capacity: 2,
+		},
+	)
+	denied := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result, _ := httplimit.ResultFromContext(r.Context())
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprintf(w, "limit %d exceeded", result.Limit)
+	})
+	handler := httplimit.New(limiter, httplimit.Header("X-User"), httplimit.WithDeniedHandler(denied))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("OK"))
+		}),
+	)
+
+	cases := []struct {
+		user       string
+		wantCode   int
+		wantBody   string
+		wantHeader map[string]string
+	}{
+		{
+			user:     "alice",
+			wantCode: http.StatusOK,
+			wantBody: "OK",
+			wantHeader: map[string]string{
+				"RateLimit-Limit":     "2",
+				"RateLimit-Remaining": "1",
+				"RateLimit-Reset":     "10",
+				"Retry-After":         "",
+			},
+		},
+		{
+			user:     "alice",
+			wantCode: http.StatusOK,
+			wantBody: "OK",
+			wantHeader: map[string]string{
+				"RateLimit-Remaining": "0",
+				"RateLimit-Reset":     "20",
+			},
+		},
+		{
+			user:     "alice",
+			wantCode: http.StatusTooManyRequests,
+			wantBody: "limit 2 exceeded",
+			wantHeader: map[string]string{
+				"RateLimit-Remaining": "0",
+				"Retry-After":         "10",
+			},
+		},
+		{
+			user:     "bob",
+			wantCode: http.StatusOK,
+			wantBody: "OK",
+			wantHeader: map[string]string{
+				"RateLimit-Remaining": "1",
+			},
+		},
+		{
+			user:     "",
+			wantCode: http.StatusBadRequest,
+			wantBody: "Bad Request\n",
+		},
+	}
+	for i, c := range cases {
+		r := httptest.NewRequest("GET", "/", nil)
+		if c.user != "" {
+			r.Header.Set("X-User", c.user)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != c.wantCode || w.Body.String() != c.wantBody {
+			t.Errorf("#%d: Got (%d, %q) != Want (%d, %q)", i, w.Code, w.Body.String(), c.wantCode, c.wantBody)
+		}
+		for name, want := range c.wantHeader {
+			if got := w.Header().Get(name); got != want {
+				t.Errorf("#%d: Got %s (%q) != Want (%q)", i, name, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package httplimit
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/RussellLuo/ratelimiter"
+	"github.com/RussellLuo/ratelimiter/internal/timer"
+)
+
+// Waiter is the keyed rate limiter consulted by Transport, which is
+// implemented by *ratelimiter.KeyedLimiter.
+type Waiter interface {
+	Wait(ctx context.Context, key string, amount int64) error
+}
+
+// Transport is an http.RoundTripper that throttles the outgoing requests,
+// e.g. for all the workers calling a third-party API to jointly stay under
+// its limits. Each request waits until it is allowed by Limiter, as well as
+// for the delay of the result (see GCRA and LeakyBucket), before being sent.
+type Transport struct {
+	// Base is the underlying RoundTripper that sends the requests.
+	// http.DefaultTransport is used if Base is nil.
+	Base http.RoundTripper
+
+	// Limiter is the keyed rate limiter consulted for each request.
+	Limiter Waiter
+
+	// KeyFunc extracts the rate-limiting key from each request.
+	// Host() is used if KeyFunc is nil.
+	KeyFunc KeyFunc
+
+	// RespectRetryAfter makes the requests under the same key wait, once
+	// a response of 429 Too Many Requests or 503 Service Unavailable comes
+	// with the Retry-After header, until the time it indicates. This is
+	// local to the Transport, which adapts to the limits of the upstream
+	// beyond Limiter.
+	RespectRetryAfter bool
+
+	mu      sync.Mutex
+	blocked map[string]time.Time
+}
+
+// RoundTrip implements http.RoundTripper by waiting for the limiter before
+// sending r. It returns ratelimiter.ErrExceedsLimit if r can never be
+// allowed, and ratelimiter.ErrExceedsDeadline if it would have to wait
+// beyond the deadline of its context.
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	keyFunc := t.KeyFunc
+	if keyFunc == nil {
+		keyFunc = Host()
+	}
+	key, err := keyFunc(r)
+	if err != nil {
+		closeBody(r)
+		return nil, err
+	}
+
+	if err := t.wait(r.Context(), key); err != nil {
+		closeBody(r)
+		return nil, err
+	}
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.RespectRetryAfter && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable) {
+		if d, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			t.block(key, time.Now().Add(d))
+		}
+	}
+	return resp, nil
+}
+
+// wait blocks until a request under key is allowed to be sent.
+func (t *Transport) wait(ctx context.Context, key string) error {
+	if d := time.Until(t.blockedUntil(key)); d > 0 {
+		if err := t.sleep(ctx, d); err != nil {
+			return err
+		}
+	}
+	return t.Limiter.Wait(ctx, key, 1)
+}
+
+// sleep is like the sleep of the middleware, but fails fast if d exceeds
+// the deadline of ctx.
+func (t *Transport) sleep(ctx context.Context, d time.Duration) error {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < d {
+		return ratelimiter.ErrExceedsDeadline
+	}
+	return timer.Sleep(ctx, d)
+}
+
+// closeBody closes the body of r, which a RoundTripper must do even if
+// r is not sent.
+func closeBody(r *http.Request) {
+	if r.Body != nil {
+		r.Body.Close()
+	}
+}
+
+func (t *Transport) block(key string, until time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.blocked == nil {
+		t.blocked = make(map[string]time.Time)
+	}
+	if until.After(t.blocked[key]) {
+		t.blocked[key] = until
+	}
+}
+
+func (t *Transport) blockedUntil(key string) time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	until, ok := t.blocked[key]
+	if ok && !time.Now().Before(until) {
+		delete(t.blocked, key)
+	}
+	return until
+}
+
+// parseRetryAfter parses the value of the Retry-After header, which is
+// either a number of seconds or an HTTP date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Duration(seconds) * time.Second, seconds > 0
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		d := date.Sub(now)
+		return d, d > 0
+	}
+	return 0, false
+}
@@ -0,0 +1,193 @@
+package httplimit_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/RussellLuo/ratelimiter"
+	"github.com/RussellLuo/ratelimiter/httplimit"
+)
+
+func TestTransport(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first request is throttled by the upstream.
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte("OK"))
+	}))
+	defer server.Close()
+
+	interval := 100 * time.Millisecond
+	clock := ratelimiter.NewFakeClock(time.Now())
+	limiter := ratelimiter.NewKeyedLimiterWithStore(
+		ratelimiter.NewMemory(ratelimiter.WithMemoryClock(clock)),
+		"test",
+		ratelimiter.AlgorithmGCRA,
+		&ratelimiter.Config{
+			Interval: interval,
+			Capacity: 1,
+		},
+	)
+	limiter.SetClock(clock)
+	client := &http.Client{
+		Transport: &httplimit.Transport{
+			Limiter:           limiter,
+			RespectRetryAfter: true,
+		},
+	}
+
+	// get sends a request, moving the clock forward whenever the limiter
+	// waits on it, and returns the status code along with the time waited
+	// for the limiter.
+	get := func() (int, time.Duration, error) {
+		type reply struct {
+			code int
+			err  error
+		}
+		done := make(chan reply, 1)
+		go func() {
+			resp, err := client.Get(server.URL)
+			if err != nil {
+				done <- reply{err: err}
+				return
+			}
+			resp.Body.Close()
+			done <- reply{code: resp.StatusCode}
+		}()
+
+		start := clock.Now()
+		for {
+			select {
+			case r := <-done:
+				return r.code, clock.Now().Sub(start), r.err
+			default:
+				if clock.Waiters() > 0 {
+					clock.Advance(interval / 10)
+				} else {
+					time.Sleep(time.Millisecond)
+				}
+			}
+		}
+	}
+
+	cases := []struct {
+		wantCode int
+		wantWait time.Duration
+	}{
+		{wantCode: http.StatusTooManyRequests, wantWait: 0},
+		// Wait for the Retry-After from the upstream, and then the limiter.
+		{wantCode: http.StatusOK, wantWait: interval},
+		// Wait for the limiter.
+		{wantCode: http.StatusOK, wantWait: interval},
+	}
+	throttled := time.Now()
+	for i, c := range cases {
+		code, wait, err := get()
+		if err != nil {
+			t.Fatalf("#%d: Err: %v", i, err)
+		}
+		if code != c.wantCode {
+			t.Errorf("#%d: Got (%d) != Want (%d)", i, code, c.wantCode)
+		}
+		if wait != c.wantWait {
+			t.Errorf("#%d: Got wait (%v) != Want (%v)", i, wait, c.wantWait)
+		}
+		// The Retry-After is waited for in real time.
+		if i == 1 {
+			if elapsed := time.Since(throttled); elapsed < time.Second {
+				t.Errorf("#%d: Got elapsed (%v) < Want (1s)", i, elapsed)
+			}
+		}
+	}
+}
+
+func TestTransport_Deadline(t *testing.T) {
+	clock := ratelimiter.NewFakeClock(time.Now())
+	limiter := ratelimiter.NewKeyedLimiterWithStore(
+		ratelimiter.NewMemory(ratelimiter.WithMemoryClock(clock)),
+		"test",
+		ratelimiter.AlgorithmGCRA,
+		&ratelimiter.Config{
+			Interval: time.Second,
+			Capacity: 5,
+		},
+	)
+	limiter.SetClock(clock)
+	transport := &httplimit.Transport{
+		Base: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		}),
+		Limiter: limiter,
+	}
+
+	r, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	if _, err := transport.RoundTrip(r); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+
+	// The request would be delayed for a second.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := transport.RoundTrip(r.WithContext(ctx)); err != ratelimiter.ErrExceedsDeadline {
+		t.Fatalf("Got (%v) != Want (%v)", err, ratelimiter.ErrExceedsDeadline)
+	}
+
+	// The capacity taken by the failed request has been given back,
+	// so the next request is delayed for a second, instead of two.
+	result, err := limiter.Allow(context.Background(), "example.com", 1)
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if !result.Allowed || result.Delay != time.Second {
+		t.Errorf("Got (%#v) != Want (Allowed: true, Delay: 1s)", result)
+	}
+}
+
+func TestTransport_CloseBody(t *testing.T) {
+	errKey := errors.New("no key")
+	transport := &httplimit.Transport{
+		Base: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			t.Fatalf("Got request sent")
+			return nil, nil
+		}),
+		KeyFunc: func(r *http.Request) (string, error) {
+			return "", errKey
+		},
+	}
+
+	body := &trackedBody{Reader: http.NoBody}
+	r, _ := http.NewRequest(http.MethodPost, "http://example.com", body)
+	if _, err := transport.RoundTrip(r); err != errKey {
+		t.Fatalf("Got (%v) != Want (%v)", err, errKey)
+	}
+	if !body.closed {
+		t.Errorf("Got body not closed")
+	}
+}
+
+type roundTripperFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// trackedBody is a request body that records whether it is closed.
+type trackedBody struct {
+	io.Reader
+	closed bool
+}
+
+func (b *trackedBody) Close() error {
+	b.closed = true
+	return nil
+}
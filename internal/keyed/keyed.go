@@ -0,0 +1,52 @@
+// Package keyed provides the keyed rate limiters shared by the middlewares
+// of ratelimiter.
+package keyed
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/RussellLuo/ratelimiter"
+)
+
+// ErrNoKey is returned by a key function if the request or call carries
+// no key.
+var ErrNoKey = errors.New("ratelimiter: no key")
+
+// Limiter is the keyed rate limiter consulted by the middlewares, which is
+// implemented by *ratelimiter.KeyedLimiter.
+type Limiter interface {
+	Allow(ctx context.Context, key string, amount int64) (ratelimiter.Result, error)
+}
+
+// LimiterFunc is an adapter to allow the use of an ordinary function as
+// a Limiter, e.g. LimiterFunc(quota.Consume) for a *ratelimiter.Quota.
+type LimiterFunc func(ctx context.Context, key string, amount int64) (ratelimiter.Result, error)
+
+// Allow implements Limiter by calling f.
+func (f LimiterFunc) Allow(ctx context.Context, key string, amount int64) (ratelimiter.Result, error) {
+	return f(ctx, key, amount)
+}
+
+// Single returns a Limiter that limits all the keys together by l,
+// e.g. for a global limit of a service.
+func Single(l ratelimiter.Limiter) Limiter {
+	return LimiterFunc(func(ctx context.Context, key string, amount int64) (ratelimiter.Result, error) {
+		return l.Allow(ctx, amount)
+	})
+}
+
+// Compose returns the key joining n keys with ":", the i-th of which is
+// extracted by extract(i).
+func Compose(n int, extract func(i int) (string, error)) (string, error) {
+	keys := make([]string, n)
+	for i := range keys {
+		key, err := extract(i)
+		if err != nil {
+			return "", err
+		}
+		keys[i] = key
+	}
+	return strings.Join(keys, ":"), nil
+}
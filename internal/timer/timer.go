@@ -0,0 +1,26 @@
+// Package timer provides the timing helpers shared by the packages of
+// ratelimiter.
+package timer
+
+import (
+	"context"
+	"time"
+)
+
+// Sleep pauses the current goroutine for at least the duration d,
+// or until ctx is done.
+func Sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
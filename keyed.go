@@ -0,0 +1,158 @@
+package ratelimiter
+
+import (
+	"context"
+)
+
+// Algorithm is a rate-limiting algorithm, which a KeyedLimiter creates
+// the limiter of each key with.
+type Algorithm int
+
+const (
+	// AlgorithmTokenBucket creates a TokenBucket for each key.
+	AlgorithmTokenBucket Algorithm = iota + 1
+	// AlgorithmLeakyBucket creates a LeakyBucket for each key.
+	AlgorithmLeakyBucket
+	// AlgorithmGCRA creates a GCRA for each key.
+	AlgorithmGCRA
+	// AlgorithmSlidingWindowLog creates a SlidingWindowLog for each key.
+	AlgorithmSlidingWindowLog
+	// AlgorithmSlidingWindowCounter creates a SlidingWindowCounter for each key.
+	AlgorithmSlidingWindowCounter
+	// AlgorithmFixedWindow creates a FixedWindow for each key.
+	AlgorithmFixedWindow
+)
+
+// newLimiter returns a new limiter of the algorithm special for key in
+// store with the specified configuration.
+func (a Algorithm) newLimiter(store Store, key string, config *Config) (Limiter, func(Clock)) {
+	switch a {
+	case AlgorithmTokenBucket:
+		l := NewTokenBucketWithStore(store, key, config)
+		return l, l.SetClock
+	case AlgorithmLeakyBucket:
+		l := NewLeakyBucketWithStore(store, key, config)
+		return l, l.SetClock
+	case AlgorithmGCRA:
+		l := NewGCRAWithStore(store, key, config)
+		return l, l.SetClock
+	case AlgorithmSlidingWindowLog:
+		l := NewSlidingWindowLogWithStore(store, key, config)
+		return l, l.SetClock
+	case AlgorithmSlidingWindowCounter:
+		l := NewSlidingWindowCounterWithStore(store, key, config)
+		return l, l.SetClock
+	case AlgorithmFixedWindow:
+		l := NewFixedWindowWithStore(store, key, config)
+		return l, l.SetClock
+	default:
+		panic("ratelimiter: unknown algorithm")
+	}
+}
+
+// ConfigFunc resolves the configuration of key, which overrides the shared
+// configuration of a KeyedLimiter unless it is nil.
+type ConfigFunc func(key string) *Config
+
+// KeyedLimiter limits many dynamic keys, e.g. one per user or per IP,
+// which share the same algorithm, store, namespace prefix and configuration.
+// The limiter of each key is created on the fly, which is lightweight since
+// all the state lives in the store.
+type KeyedLimiter struct {
+	baseBucket
+
+	store      Store
+	prefix     string
+	algorithm  Algorithm
+	configFunc ConfigFunc
+	policy     FailurePolicy
+	local      *Memory
+}
+
+// NewKeyedLimiter returns a new keyed rate limiter of algorithm, for the
+// keys namespaced by prefix in redis with the specified shared configuration.
+// It panics if algorithm is unknown.
+func NewKeyedLimiter(redis Redis, prefix string, algorithm Algorithm, config *Config) *KeyedLimiter {
+	return NewKeyedLimiterWithStore(NewRedisStore(redis), prefix, algorithm, config)
+}
+
+// NewKeyedLimiterWithStore returns a new keyed rate limiter of algorithm, for the
+// keys namespaced by prefix in store with the specified shared configuration.
+// It panics if algorithm is unknown.
+func NewKeyedLimiterWithStore(store Store, prefix string, algorithm Algorithm, config *Config) *KeyedLimiter {
+	if algorithm < AlgorithmTokenBucket || algorithm > AlgorithmFixedWindow {
+		panic("ratelimiter: unknown algorithm")
+	}
+
+	return &KeyedLimiter{
+		baseBucket: baseBucket{config: config},
+		store:      store,
+		prefix:     prefix,
+		algorithm:  algorithm,
+	}
+}
+
+// SetConfigFunc sets the function resolving the per-key configuration
+// overrides in a concurrency-safe way.
+func (k *KeyedLimiter) SetConfigFunc(f ConfigFunc) {
+	k.mu.Lock()
+	k.configFunc = f
+	k.mu.Unlock()
+}
+
+// SetFailurePolicy sets the policy applied when the store fails in
+// a concurrency-safe way. For FailLocal, the local limiters of all the
+// keys share one in-memory store of the keyed limiter.
+func (k *KeyedLimiter) SetFailurePolicy(policy FailurePolicy) {
+	clock := k.Clock()
+
+	k.mu.Lock()
+	k.policy = policy
+	if policy.mode == failLocal && k.local == nil {
+		k.local = NewMemory(WithMemoryClock(clock))
+	}
+	k.mu.Unlock()
+}
+
+// Limiter returns the limiter of key.
+func (k *KeyedLimiter) Limiter(key string) Limiter {
+	k.mu.RLock()
+	config, clock, configFunc, policy, local := k.config, k.clock, k.configFunc, k.policy, k.local
+	k.mu.RUnlock()
+
+	if configFunc != nil {
+		if c := configFunc(key); c != nil {
+			config = c
+		}
+	}
+
+	l, setClock := k.algorithm.newLimiter(k.store, k.prefix+":"+key, config)
+	if clock != nil {
+		setClock(clock)
+	}
+	if policy.mode == failWithError {
+		return l
+	}
+
+	f := &FailSafe{limiter: l, policy: policy, clock: k.Clock()}
+	if policy.mode == failLocal {
+		f.local = newLocalLimiter(local, k.algorithm, k.prefix+":"+key, policy.localConfig(k.algorithm, *config), f.clock)
+	}
+	return f
+}
+
+// Allow reports whether amount units are allowed to pass for key.
+func (k *KeyedLimiter) Allow(ctx context.Context, key string, amount int64) (Result, error) {
+	return k.Limiter(key).Allow(ctx, amount)
+}
+
+// Wait blocks until amount units are allowed to pass for key.
+func (k *KeyedLimiter) Wait(ctx context.Context, key string, amount int64) error {
+	return k.Limiter(key).Wait(ctx, amount)
+}
+
+// Reserve reserves amount units for key, which may be returned back to
+// the limiter by calling Cancel on the returned reservation.
+func (k *KeyedLimiter) Reserve(ctx context.Context, key string, amount int64) (*Reservation, error) {
+	return k.Limiter(key).Reserve(ctx, amount)
+}
@@ -0,0 +1,82 @@
+package ratelimiter_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RussellLuo/ratelimiter"
+	"github.com/go-redis/redis"
+)
+
+func TestKeyedLimiter_Allow(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	prefix := "ratelimiter:keyed:test"
+	config := &ratelimiter.Config{
+		Interval: 1 * time.Second / 2,
+		Capacity: 5,
+	}
+
+	stores := map[string]ratelimiter.Store{
+		"redis":  ratelimiter.NewRedisStore(&Redis{client}),
+		"memory": ratelimiter.NewMemory(),
+	}
+	for name, store := range stores {
+		client.Del(prefix+":alice", prefix+":bob", prefix+":vip:carol")
+
+		limiter := ratelimiter.NewKeyedLimiterWithStore(store, prefix, ratelimiter.AlgorithmTokenBucket, config)
+		limiter.SetConfigFunc(func(key string) *ratelimiter.Config {
+			if key == "vip:carol" {
+				return &ratelimiter.Config{Interval: config.Interval, Capacity: 10}
+			}
+			return nil
+		})
+
+		cases := []struct {
+			key    string
+			amount int64
+			want   ratelimiter.Result
+		}{
+			{
+				key:    "alice",
+				amount: 5,
+				want:   ratelimiter.Result{Allowed: true, Limit: 5, Remaining: 0},
+			},
+			{
+				key:    "alice",
+				amount: 1,
+				want:   ratelimiter.Result{Allowed: false, Limit: 5, Remaining: 0},
+			},
+			// Each key has a bucket of its own.
+			{
+				key:    "bob",
+				amount: 1,
+				want:   ratelimiter.Result{Allowed: true, Limit: 5, Remaining: 4},
+			},
+			// The configuration is overridden per key.
+			{
+				key:    "vip:carol",
+				amount: 8,
+				want:   ratelimiter.Result{Allowed: true, Limit: 10, Remaining: 2},
+			},
+		}
+		for _, c := range cases {
+			got, err := limiter.Allow(context.Background(), c.key, c.amount)
+			if err != nil {
+				t.Fatalf("%s: Err: %v", name, err)
+			}
+			if !(got.Allowed == c.want.Allowed && got.Limit == c.want.Limit && got.Remaining == c.want.Remaining) {
+				t.Errorf("%s: %s: Got (%#v) != Want (%#v)", name, c.key, got, c.want)
+			}
+		}
+
+		// The keys are namespaced by the prefix.
+		if name == "redis" {
+			if n := client.Exists(prefix+":alice", prefix+":bob", prefix+":vip:carol").Val(); n != 3 {
+				t.Errorf("%s: Got (%d) keys != Want (3)", name, n)
+			}
+		}
+	}
+}
@@ -1,23 +1,26 @@
 package ratelimiter
 
 import (
+	"context"
 	"time"
 )
 
 // the Lua script that implements the Leaky Bucket Algorithm as a meter.
 // bucket.wl represents the water level,
 // bucket.ts represents the timestamp of the last time the bucket was refilled.
-const luaLeakyBucket = `
+// The bucket expires once it is empty, which is identical to a new bucket.
+const luaLeakyBucket = luaClock + `
 local key = KEYS[1]
 local interval = tonumber(ARGV[1])
 local capacity = tonumber(ARGV[2])
-local now = tonumber(ARGV[3])
+local now = clock(tonumber(ARGV[3]))
 local amount = tonumber(ARGV[4])
 
 local bucket = {wl=0, ts=now}
 local value = redis.call("get", key)
 if value then
   bucket = cjson.decode(value)
+  bucket.ts = tonumber(bucket.ts)
 end
 
 local leaks = math.floor((now - bucket.ts) / interval)
@@ -26,60 +29,218 @@ if leaks > 0 then
   bucket.ts = bucket.ts + leaks * interval
 end
 
+local allowed = 0
+local delayed = 0
+local retry_after = 0
 if bucket.wl + amount <= capacity then
-  local delayed = math.max(bucket.wl * interval - (now - bucket.ts), 0)
+  delayed = math.max(bucket.wl * interval - (now - bucket.ts), 0)
   bucket.wl = bucket.wl + amount
-  bucket.ts = string.format("%.f", bucket.ts)
-  if redis.call("set", key, cjson.encode(bucket)) then
-    return delayed
+  local ttl = math.ceil((bucket.wl * interval - (now - bucket.ts)) / 1000)
+  if ttl > 0 then
+    redis.call("set", key, cjson.encode({wl=bucket.wl, ts=string.format("%.f", bucket.ts)}), "px", string.format("%.f", ttl))
+  else
+    redis.call("del", key)
   end
+  allowed = 1
+else
+  retry_after = (bucket.wl + amount - capacity) * interval - (now - bucket.ts)
 end
 
-return -1
+local reset_after = math.max(bucket.wl * interval - (now - bucket.ts), 0)
+return {allowed, capacity - bucket.wl, delayed, retry_after, reset_after}
 `
 
+// the Lua script that takes amount units of water out of the bucket,
+// without going below the empty level.
+const luaLeakyBucketRefund = luaClock + `
+local key = KEYS[1]
+local interval = tonumber(ARGV[1])
+local now = clock(tonumber(ARGV[2]))
+local amount = tonumber(ARGV[3])
+
+local value = redis.call("get", key)
+if not value then
+  return {0}
+end
+
+local bucket = cjson.decode(value)
+bucket.ts = tonumber(bucket.ts)
+
+local leaks = math.floor((now - bucket.ts) / interval)
+if leaks > 0 then
+  bucket.ts = bucket.ts + leaks * interval
+end
+
+bucket.wl = math.max(bucket.wl - math.max(leaks, 0) - amount, 0)
+local ttl = math.ceil((bucket.wl * interval - (now - bucket.ts)) / 1000)
+if ttl > 0 then
+  redis.call("set", key, cjson.encode({wl=bucket.wl, ts=string.format("%.f", bucket.ts)}), "px", string.format("%.f", ttl))
+else
+  redis.call("del", key)
+end
+return {1}
+`
+
+// leakyBucket is the Go function equivalent to luaLeakyBucket.
+func leakyBucket(tx Tx, keys []string, args []int64) ([]int64, error) {
+	key := keys[0]
+	interval, capacity, now, amount := args[0], args[1], args[2], args[3]
+
+	wl, ts := int64(0), now
+	value, ok, err := tx.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		if err := decodeState(value, &wl, &ts); err != nil {
+			return nil, err
+		}
+	}
+
+	leaks := floorDiv(now-ts, interval)
+	if leaks > 0 {
+		wl = maxInt64(wl-leaks, 0)
+		ts = ts + leaks*interval
+	}
+
+	var allowed, delayed, retryAfter int64
+	if wl+amount <= capacity {
+		delayed = maxInt64(wl*interval-(now-ts), 0)
+		wl = wl + amount
+		if err := setOrDel(tx, key, encodeState(wl, ts), wl*interval-(now-ts)); err != nil {
+			return nil, err
+		}
+		allowed = 1
+	} else {
+		retryAfter = (wl+amount-capacity)*interval - (now - ts)
+	}
+
+	resetAfter := maxInt64(wl*interval-(now-ts), 0)
+	return []int64{allowed, capacity - wl, delayed, retryAfter, resetAfter}, nil
+}
+
+// leakyBucketRefund is the Go function equivalent to luaLeakyBucketRefund.
+func leakyBucketRefund(tx Tx, keys []string, args []int64) ([]int64, error) {
+	key := keys[0]
+	interval, now, amount := args[0], args[1], args[2]
+
+	value, ok, err := tx.Get(key)
+	if err != nil || !ok {
+		return []int64{0}, err
+	}
+	var wl, ts int64
+	if err := decodeState(value, &wl, &ts); err != nil {
+		return nil, err
+	}
+
+	leaks := floorDiv(now-ts, interval)
+	if leaks > 0 {
+		ts = ts + leaks*interval
+	}
+
+	wl = maxInt64(wl-maxInt64(leaks, 0)-amount, 0)
+	if err := setOrDel(tx, key, encodeState(wl, ts), wl*interval-(now-ts)); err != nil {
+		return nil, err
+	}
+	return []int64{1}, nil
+}
+
+var (
+	leakyBucketOp       = newOp("leakybucket", luaLeakyBucket, 2, leakyBucket)
+	leakyBucketRefundOp = newOp("leakybucket.refund", luaLeakyBucketRefund, 1, leakyBucketRefund)
+)
+
 // LeakyBucket implements the Leaky Bucket Algorithm as a meter.
 // See https://en.wikipedia.org/wiki/Leaky_bucket#The_Leaky_Bucket_Algorithm_as_a_Meter.
 type LeakyBucket struct {
 	baseBucket
 
-	script *Script
-	key    string
+	store Store
+	key   string
 }
 
 // NewLeakyBucket returns a new leaky-bucket rate limiter special for key in redis
 // with the specified bucket configuration.
 func NewLeakyBucket(redis Redis, key string, config *Config) *LeakyBucket {
+	return NewLeakyBucketWithStore(NewRedisStore(redis), key, config)
+}
+
+// NewLeakyBucketWithStore returns a new leaky-bucket rate limiter special for key in store
+// with the specified bucket configuration.
+func NewLeakyBucketWithStore(store Store, key string, config *Config) *LeakyBucket {
 	return &LeakyBucket{
 		baseBucket: baseBucket{config: config},
-		script:     NewScript(redis, luaLeakyBucket),
+		store:      store,
 		key:        key,
 	}
 }
 
 // Give gives amount units of water into the bucket.
 func (b *LeakyBucket) Give(amount int64) (bool, time.Duration, error) {
+	r, err := b.Allow(context.Background(), amount)
+	if !r.Allowed {
+		return false, -1, err
+	}
+	return true, r.Delay, nil
+}
+
+// Allow implements Limiter by giving amount units of water into the bucket.
+func (b *LeakyBucket) Allow(ctx context.Context, amount int64) (Result, error) {
+	return b.prepare(amount).exec(ctx)
+}
+
+// prepare prepares the call for giving amount drops to the bucket.
+func (b *LeakyBucket) prepare(amount int64) *call {
 	config := b.Config()
 	if amount > config.Capacity {
-		return false, -1, nil
+		return resolvedCall(newUnsatisfiableResult(config.Capacity))
+	}
+
+	now := b.Clock().Now()
+	return &call{
+		store: b.store,
+		op:    leakyBucketOp,
+		keys:  []string{b.key},
+		args: []int64{
+			int64(config.Interval / time.Microsecond),
+			config.Capacity,
+			int64(time.Duration(now.UnixNano()) / time.Microsecond),
+			amount,
+		},
+		limit: config.Capacity,
+		now:   now,
+	}
+}
+
+// Wait implements Limiter by giving amount units of water into the bucket
+// and blocking until they conform.
+func (b *LeakyBucket) Wait(ctx context.Context, amount int64) error {
+	return wait(ctx, b, amount)
+}
+
+// Reserve implements Limiter by giving amount units of water into the bucket,
+// which will be taken out if the reservation is cancelled.
+func (b *LeakyBucket) Reserve(ctx context.Context, amount int64) (*Reservation, error) {
+	r, err := b.Allow(ctx, amount)
+	if err != nil {
+		return nil, err
 	}
+	return newReservation(r, b.Clock(), func(ctx context.Context) error {
+		return b.refund(ctx, amount)
+	}), nil
+}
 
-	now := time.Now().UnixNano()
-	result, err := b.script.Run(
+// refund takes amount units of water out of the bucket.
+func (b *LeakyBucket) refund(ctx context.Context, amount int64) error {
+	config := b.Config()
+	now := b.Clock().Now().UnixNano()
+	_, err := b.store.Exec(
+		ctx,
+		leakyBucketRefundOp,
 		[]string{b.key},
 		int64(config.Interval/time.Microsecond),
-		config.Capacity,
 		int64(time.Duration(now)/time.Microsecond),
 		amount,
 	)
-	if err != nil {
-		return false, -1, err
-	} else {
-		switch delayed := result.(int64); delayed {
-		case -1:
-			return false, -1, nil
-		default:
-			return true, time.Duration(delayed) * time.Microsecond, nil
-		}
-	}
+	return err
 }
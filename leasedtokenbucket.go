@@ -0,0 +1,285 @@
+package ratelimiter
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// LeaseConfig is the configuration of the leases of a LeasedTokenBucket,
+// which trades the accuracy of the global limit for fewer round trips.
+type LeaseConfig struct {
+	// Size is the number of tokens leased from the bucket at once, which
+	// are then served locally without a round trip. The larger it is,
+	// the fewer round trips are needed, and the further the global limit
+	// can be overshot (see LeaseStats).
+	Size int64
+
+	// TTL is the duration for which the leased tokens are served locally.
+	// Once the lease expires, the unused tokens are returned to the bucket
+	// on the next call, or by Flush. The longer it is, the later the unused
+	// tokens become available to the other processes.
+	//
+	// Note that no timer returns them, so an idle process holds its unused
+	// tokens until it is called again, unless Flush is called, e.g. when
+	// the process goes idle or exits.
+	TTL time.Duration
+}
+
+// LeaseStats is the statistics of a LeasedTokenBucket.
+type LeaseStats struct {
+	// Leases is the number of round trips made for leasing tokens,
+	// including the ones whose lease is rejected by the bucket.
+	Leases int64
+
+	// LocalHits is the number of requests served locally, i.e. without
+	// a round trip.
+	LocalHits int64
+
+	// Returned is the number of unused tokens returned to the bucket.
+	Returned int64
+
+	// Outstanding is the number of leased tokens currently held locally.
+	// Since the tokens are taken from the bucket when they are leased, but
+	// may be served until the lease expires, the tokens served within any
+	// interval can exceed the limit of the bucket by the tokens outstanding
+	// at the beginning of the interval.
+	Outstanding int64
+
+	// MaxOvershoot is the upper bound of Outstanding, i.e. how far the
+	// global limit can be overshot by this process. The bound for all the
+	// processes sharing the bucket is the sum of theirs.
+	MaxOvershoot int64
+}
+
+// LeasedTokenBucket is a token bucket that leases tokens in batches from
+// a TokenBucket shared by many processes, and serves them locally to cut
+// the round trips to the store.
+type LeasedTokenBucket struct {
+	bucket *TokenBucket
+	config *LeaseConfig
+
+	mu        sync.Mutex
+	tokens    int64
+	expiresAt time.Time
+	stats     LeaseStats
+
+	// refreshing is closed once the lease in flight is taken, or nil if
+	// there is none.
+	refreshing chan struct{}
+}
+
+// NewLeasedTokenBucket returns a new leased token bucket, which leases
+// tokens from bucket with the specified lease configuration.
+// It panics if Size or TTL of config is not positive.
+func NewLeasedTokenBucket(bucket *TokenBucket, config *LeaseConfig) *LeasedTokenBucket {
+	if config.Size <= 0 {
+		panic("ratelimiter: non-positive lease size")
+	}
+	if config.TTL <= 0 {
+		panic("ratelimiter: non-positive lease TTL")
+	}
+
+	return &LeasedTokenBucket{
+		bucket: bucket,
+		config: config,
+	}
+}
+
+// Take takes amount tokens from the bucket.
+func (b *LeasedTokenBucket) Take(amount int64) (bool, error) {
+	r, err := b.Allow(context.Background(), amount)
+	return r.Allowed, err
+}
+
+// Allow implements Limiter by taking amount tokens from the local lease,
+// or from a new lease if the local one is insufficient. The Remaining of
+// the result is the number of tokens left in the local lease.
+//
+// Only one lease is taken at a time, and without holding up the requests
+// that the local lease still suffices for. The others wait for the lease
+// in flight instead of taking one of their own.
+func (b *LeasedTokenBucket) Allow(ctx context.Context, amount int64) (Result, error) {
+	config := b.bucket.Config()
+	if amount > config.Capacity {
+		return newUnsatisfiableResult(config.Capacity), nil
+	}
+
+	for {
+		b.mu.Lock()
+		now := b.bucket.Clock().Now()
+		expired := !now.Before(b.expiresAt)
+		if !expired && b.tokens >= amount {
+			b.tokens -= amount
+			b.stats.LocalHits++
+			r := b.result(config.Capacity, now)
+			b.mu.Unlock()
+			return r, nil
+		}
+
+		if done := b.refreshing; done != nil {
+			b.mu.Unlock()
+			select {
+			case <-done:
+				continue
+			case <-ctx.Done():
+				return Result{}, ctx.Err()
+			}
+		}
+
+		done := make(chan struct{})
+		b.refreshing = done
+		var local, expiredTokens int64
+		if expired {
+			expiredTokens, b.tokens = b.tokens, 0
+		} else {
+			local = b.tokens
+		}
+		b.mu.Unlock()
+
+		r, ok, err := b.lease(ctx, config.Capacity, amount, local, expiredTokens, now)
+
+		b.mu.Lock()
+		b.refreshing = nil
+		close(done)
+		b.mu.Unlock()
+		if ok || err != nil {
+			return r, err
+		}
+	}
+}
+
+// lease returns the expired tokens to the bucket, and then takes a new
+// lease at now for amount tokens, given that local tokens are left in the
+// local lease. It must only be called by the caller that set refreshing.
+//
+// It reports false if the local tokens counted on were taken by the other
+// requests in the meantime, in which case the request is to be retried.
+func (b *LeasedTokenBucket) lease(ctx context.Context, capacity, amount, local, expired int64, now time.Time) (Result, bool, error) {
+	if expired > 0 {
+		if err := b.giveBack(ctx, expired); err != nil {
+			return Result{}, false, err
+		}
+	}
+
+	// Lease a batch of tokens, or only the missing ones if the bucket
+	// cannot afford a batch.
+	need := amount - local
+	size := minInt64(maxInt64(b.config.Size, need), capacity)
+	leases := int64(1)
+	r, err := b.bucket.Allow(ctx, size)
+	if err == nil && !r.Allowed && size > need {
+		size = need
+		r, err = b.bucket.Allow(ctx, size)
+		leases++
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.stats.Leases += leases
+	if err != nil {
+		return Result{}, false, err
+	}
+	if !r.Allowed {
+		return r, true, nil
+	}
+
+	b.tokens += size
+	b.expiresAt = now.Add(b.config.TTL)
+	if b.tokens < amount {
+		return Result{}, false, nil
+	}
+	b.tokens -= amount
+	return b.result(capacity, now), true, nil
+}
+
+// result returns the result of the allowed request at now, whose
+// ResetAfter is the remaining duration of the local lease.
+func (b *LeasedTokenBucket) result(limit int64, now time.Time) Result {
+	return Result{
+		Allowed:    true,
+		Limit:      limit,
+		Remaining:  b.tokens,
+		ResetAfter: b.expiresAt.Sub(now),
+		ResetAt:    b.expiresAt,
+	}
+}
+
+// Wait implements Limiter by blocking until amount tokens can be taken from the bucket.
+func (b *LeasedTokenBucket) Wait(ctx context.Context, amount int64) error {
+	return wait(ctx, b, amount)
+}
+
+// Reserve implements Limiter by taking amount tokens from the bucket,
+// which will be returned back to the local lease if the reservation is
+// cancelled. The tokens that the local lease cannot hold, since it never
+// holds more than MaxOvershoot, are returned to the bucket instead.
+func (b *LeasedTokenBucket) Reserve(ctx context.Context, amount int64) (*Reservation, error) {
+	r, err := b.Allow(ctx, amount)
+	if err != nil {
+		return nil, err
+	}
+	return newReservation(r, b.bucket.Clock(), func(ctx context.Context) error {
+		maxTokens := b.maxOutstanding()
+
+		b.mu.Lock()
+		b.tokens += amount
+		excess := b.tokens - maxTokens
+		if excess <= 0 {
+			b.mu.Unlock()
+			return nil
+		}
+		b.tokens = maxTokens
+		b.mu.Unlock()
+
+		return b.giveBack(ctx, excess)
+	}), nil
+}
+
+// Flush returns the unused tokens of the local lease to the bucket,
+// e.g. before the process exits.
+func (b *LeasedTokenBucket) Flush(ctx context.Context) error {
+	b.mu.Lock()
+	tokens := b.tokens
+	b.tokens = 0
+	b.expiresAt = time.Time{}
+	b.mu.Unlock()
+
+	if tokens == 0 {
+		return nil
+	}
+	return b.giveBack(ctx, tokens)
+}
+
+// giveBack returns tokens taken out of the local lease to the bucket, or
+// puts them back into the local lease if it fails.
+func (b *LeasedTokenBucket) giveBack(ctx context.Context, tokens int64) error {
+	err := b.bucket.refund(ctx, tokens)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err != nil {
+		b.tokens += tokens
+		return err
+	}
+	b.stats.Returned += tokens
+	return nil
+}
+
+// maxOutstanding returns the maximum number of tokens held locally.
+func (b *LeasedTokenBucket) maxOutstanding() int64 {
+	return minInt64(b.config.Size, b.bucket.Config().Capacity)
+}
+
+// Stats returns the statistics of the leases.
+func (b *LeasedTokenBucket) Stats() LeaseStats {
+	maxTokens := b.maxOutstanding()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stats := b.stats
+	stats.Outstanding = b.tokens
+	stats.MaxOvershoot = maxTokens
+	return stats
+}
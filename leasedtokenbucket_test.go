@@ -0,0 +1,308 @@
+package ratelimiter_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RussellLuo/ratelimiter"
+)
+
+func TestLeasedTokenBucket_Allow(t *testing.T) {
+	store := newDownStore()
+	clock := ratelimiter.NewFakeClock(time.Now())
+	tb := ratelimiter.NewTokenBucketWithStore(store, "ratelimiter:leasedtokenbucket:test", &ratelimiter.Config{
+		Interval: 100 * time.Millisecond,
+		Capacity: 10,
+	})
+	tb.SetClock(clock)
+	bucket := ratelimiter.NewLeasedTokenBucket(tb, &ratelimiter.LeaseConfig{
+		Size: 4,
+		TTL:  time.Second,
+	})
+
+	cases := []struct {
+		advance time.Duration
+		amount  int64
+		want    ratelimiter.Result
+		calls   int
+	}{
+		// A lease of 4 tokens is taken from the bucket.
+		{
+			amount: 1,
+			want:   ratelimiter.Result{Allowed: true, Limit: 10, Remaining: 3},
+			calls:  1,
+		},
+		// The leased tokens are served locally.
+		{
+			amount: 3,
+			want:   ratelimiter.Result{Allowed: true, Limit: 10, Remaining: 0},
+			calls:  1,
+		},
+		{
+			amount: 2,
+			want:   ratelimiter.Result{Allowed: true, Limit: 10, Remaining: 2},
+			calls:  2,
+		},
+		// The unused tokens are returned once the lease expires,
+		// and a new lease is taken.
+		{
+			advance: time.Second,
+			amount:  1,
+			want:    ratelimiter.Result{Allowed: true, Limit: 10, Remaining: 3},
+			calls:   4,
+		},
+	}
+	for i, c := range cases {
+		clock.Advance(c.advance)
+		got, err := bucket.Allow(context.Background(), c.amount)
+		if err != nil {
+			t.Fatalf("#%d: Err: %v", i, err)
+		}
+		if !(got.Allowed == c.want.Allowed && got.Limit == c.want.Limit && got.Remaining == c.want.Remaining) {
+			t.Errorf("#%d: Got (%#v) != Want (%#v)", i, got, c.want)
+		}
+		if n := store.Calls(); n != c.calls {
+			t.Errorf("#%d: Got (%d) calls != Want (%d)", i, n, c.calls)
+		}
+	}
+
+	want := ratelimiter.LeaseStats{
+		Leases:       3,
+		LocalHits:    1,
+		Returned:     2,
+		Outstanding:  3,
+		MaxOvershoot: 4,
+	}
+	if got := bucket.Stats(); got != want {
+		t.Errorf("Got (%#v) != Want (%#v)", got, want)
+	}
+}
+
+func TestLeasedTokenBucket_Shortage(t *testing.T) {
+	store := newDownStore()
+	clock := ratelimiter.NewFakeClock(time.Now())
+	tb := ratelimiter.NewTokenBucketWithStore(store, "ratelimiter:leasedtokenbucket:test", &ratelimiter.Config{
+		Interval: 100 * time.Millisecond,
+		Capacity: 5,
+	})
+	tb.SetClock(clock)
+	bucket := ratelimiter.NewLeasedTokenBucket(tb, &ratelimiter.LeaseConfig{
+		Size: 4,
+		TTL:  time.Second,
+	})
+
+	cases := []struct {
+		amount int64
+		want   ratelimiter.Result
+	}{
+		{
+			amount: 4,
+			want:   ratelimiter.Result{Allowed: true, Limit: 5, Remaining: 0},
+		},
+		// Only the missing tokens are taken if a lease cannot be afforded.
+		{
+			amount: 1,
+			want:   ratelimiter.Result{Allowed: true, Limit: 5, Remaining: 0},
+		},
+		{
+			amount: 1,
+			want:   ratelimiter.Result{Allowed: false, Limit: 5, Remaining: 0, RetryAfter: 100 * time.Millisecond},
+		},
+		{
+			amount: 6,
+			want:   ratelimiter.Result{Allowed: false, Limit: 5, Remaining: 0, RetryAfter: -1},
+		},
+	}
+	for i, c := range cases {
+		got, err := bucket.Allow(context.Background(), c.amount)
+		if err != nil {
+			t.Fatalf("#%d: Err: %v", i, err)
+		}
+		if !(got.Allowed == c.want.Allowed && got.Limit == c.want.Limit &&
+			got.Remaining == c.want.Remaining && got.RetryAfter == c.want.RetryAfter) {
+			t.Errorf("#%d: Got (%#v) != Want (%#v)", i, got, c.want)
+		}
+	}
+
+	// Each rejected lease is a round trip too.
+	if s := bucket.Stats(); s.Leases != 5 || store.Calls() != 5 {
+		t.Errorf("Got (%d) leases and (%d) calls != Want (5)", s.Leases, store.Calls())
+	}
+}
+
+func TestLeasedTokenBucket_InvalidConfig(t *testing.T) {
+	tb := ratelimiter.NewTokenBucketWithStore(ratelimiter.NewMemory(), "ratelimiter:leasedtokenbucket:test", &ratelimiter.Config{
+		Interval: time.Second,
+		Capacity: 10,
+	})
+
+	for _, config := range []*ratelimiter.LeaseConfig{
+		{Size: 0, TTL: time.Second},
+		{Size: 5, TTL: 0},
+		{Size: 5, TTL: -time.Second},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Got no panic for (%#v)", config)
+				}
+			}()
+			ratelimiter.NewLeasedTokenBucket(tb, config)
+		}()
+	}
+}
+
+func TestLeasedTokenBucket_Flush(t *testing.T) {
+	store := newDownStore()
+	clock := ratelimiter.NewFakeClock(time.Now())
+	tb := ratelimiter.NewTokenBucketWithStore(store, "ratelimiter:leasedtokenbucket:test", &ratelimiter.Config{
+		Interval: time.Second,
+		Capacity: 10,
+	})
+	tb.SetClock(clock)
+	bucket := ratelimiter.NewLeasedTokenBucket(tb, &ratelimiter.LeaseConfig{
+		Size: 8,
+		TTL:  time.Minute,
+	})
+
+	if _, err := bucket.Allow(context.Background(), 1); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	// The cancelled reservation is returned to the local lease.
+	r, err := bucket.Reserve(context.Background(), 2)
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if err := r.Cancel(context.Background()); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if err := bucket.Flush(context.Background()); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+
+	got, err := tb.Allow(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if got.Remaining != 9 {
+		t.Errorf("Got (%d) remaining tokens != Want (9)", got.Remaining)
+	}
+	if s := bucket.Stats(); s.Returned != 7 || s.Outstanding != 0 {
+		t.Errorf("Got (%#v) != Want (Returned: 7, Outstanding: 0)", s)
+	}
+}
+
+// gatedStore makes each Exec wait until released, once gated.
+type gatedStore struct {
+	ratelimiter.Store
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (s *gatedStore) Exec(ctx context.Context, op *ratelimiter.Op, keys []string, args ...int64) ([]int64, error) {
+	if s.entered != nil {
+		s.entered <- struct{}{}
+		<-s.release
+	}
+	return s.Store.Exec(ctx, op, keys, args...)
+}
+
+func TestLeasedTokenBucket_LeaseInFlight(t *testing.T) {
+	clock := ratelimiter.NewFakeClock(time.Now())
+	store := &gatedStore{Store: ratelimiter.NewMemory(ratelimiter.WithMemoryClock(clock))}
+	tb := ratelimiter.NewTokenBucketWithStore(store, "ratelimiter:leasedtokenbucket:test", &ratelimiter.Config{
+		Interval: time.Second,
+		Capacity: 10,
+	})
+	tb.SetClock(clock)
+	bucket := ratelimiter.NewLeasedTokenBucket(tb, &ratelimiter.LeaseConfig{
+		Size: 4,
+		TTL:  time.Minute,
+	})
+	ctx := context.Background()
+
+	if _, err := bucket.Allow(ctx, 1); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+
+	// A request that the local lease is insufficient for takes a new lease,
+	// which hangs.
+	store.entered = make(chan struct{})
+	store.release = make(chan struct{})
+	leased := make(chan ratelimiter.Result)
+	go func() {
+		r, err := bucket.Allow(ctx, 4)
+		if err != nil {
+			t.Errorf("Err: %v", err)
+		}
+		leased <- r
+	}()
+	<-store.entered
+
+	// The local lease is still served meanwhile.
+	if got, err := bucket.Allow(ctx, 1); err != nil || !got.Allowed || got.Remaining != 2 {
+		t.Errorf("Got (%#v, %v) != Want (Allowed: true, Remaining: 2)", got, err)
+	}
+	// The others wait for the lease in flight, until their context is done.
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := bucket.Allow(cancelled, 4); err != context.Canceled {
+		t.Errorf("Got (%v) != Want (%v)", err, context.Canceled)
+	}
+
+	close(store.release)
+	if got := <-leased; !got.Allowed || got.Remaining != 2 {
+		t.Errorf("Got (%#v) != Want (Allowed: true, Remaining: 2)", got)
+	}
+	want := ratelimiter.LeaseStats{
+		Leases:       2,
+		LocalHits:    1,
+		Outstanding:  2,
+		MaxOvershoot: 4,
+	}
+	if got := bucket.Stats(); got != want {
+		t.Errorf("Got (%#v) != Want (%#v)", got, want)
+	}
+}
+
+func TestLeasedTokenBucket_CancelBeyondLease(t *testing.T) {
+	clock := ratelimiter.NewFakeClock(time.Now())
+	tb := ratelimiter.NewTokenBucketWithStore(ratelimiter.NewMemory(ratelimiter.WithMemoryClock(clock)), "ratelimiter:leasedtokenbucket:test", &ratelimiter.Config{
+		Interval: time.Second,
+		Capacity: 10,
+	})
+	tb.SetClock(clock)
+	bucket := ratelimiter.NewLeasedTokenBucket(tb, &ratelimiter.LeaseConfig{
+		Size: 4,
+		TTL:  time.Minute,
+	})
+	ctx := context.Background()
+
+	if _, err := bucket.Allow(ctx, 1); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	r, err := bucket.Reserve(ctx, 3)
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if _, err := bucket.Allow(ctx, 2); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+
+	// The local lease holds no more than its size, and the excess goes
+	// back to the bucket.
+	if err := r.Cancel(ctx); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if s := bucket.Stats(); s.Outstanding != 4 || s.Returned != 1 {
+		t.Errorf("Got (%#v) != Want (Outstanding: 4, Returned: 1)", s)
+	}
+	got, err := tb.Allow(ctx, 0)
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if got.Remaining != 3 {
+		t.Errorf("Got (%d) remaining tokens != Want (3)", got.Remaining)
+	}
+}
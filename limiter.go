@@ -0,0 +1,159 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/RussellLuo/ratelimiter/internal/timer"
+)
+
+var (
+	// ErrExceedsLimit is returned by Wait if the amount exceeds the limit,
+	// in which case the request can never be allowed.
+	ErrExceedsLimit = errors.New("ratelimiter: amount exceeds limit")
+
+	// ErrExceedsDeadline is returned by Wait if the caller would have to
+	// wait beyond the deadline of the context.
+	ErrExceedsDeadline = errors.New("ratelimiter: would exceed context deadline")
+)
+
+// Result is the outcome of a single rate-limiting decision.
+type Result struct {
+	// Allowed reports whether the request is allowed.
+	Allowed bool
+
+	// Limit is the maximum amount that can pass at once,
+	// i.e. the capacity of the bucket.
+	Limit int64
+
+	// Remaining is the amount that can still pass right now.
+	Remaining int64
+
+	// Delay is the duration the caller must wait before the request
+	// is actually conforming. It is only meaningful when Allowed is true,
+	// and is always zero for the token bucket algorithm.
+	Delay time.Duration
+
+	// RetryAfter is the duration after which the same request will be
+	// allowed. It is zero when Allowed is true, and is -1 when the request
+	// can never be allowed (i.e. the amount exceeds Limit).
+	RetryAfter time.Duration
+
+	// ResetAfter is the duration after which the limiter returns to
+	// its initial state, where Remaining equals Limit.
+	ResetAfter time.Duration
+
+	// ResetAt is the time at which the limiter returns to its initial
+	// state, i.e. the time of the decision plus ResetAfter.
+	ResetAt time.Time
+}
+
+// Limiter is the common interface implemented by all the rate-limiting
+// algorithms in this package, which makes them interchangeable.
+type Limiter interface {
+	// Allow reports whether amount units are allowed to pass.
+	// It returns ctx.Err() if ctx is done before the decision is made.
+	Allow(ctx context.Context, amount int64) (Result, error)
+
+	// Wait blocks until amount units are allowed to pass.
+	// It returns an error if amount exceeds the limit, if ctx is done,
+	// or if the required delay exceeds the deadline of ctx.
+	Wait(ctx context.Context, amount int64) error
+
+	// Reserve reserves amount units, which may be returned back by
+	// cancelling the reservation if they end up unused.
+	Reserve(ctx context.Context, amount int64) (*Reservation, error)
+}
+
+var (
+	_ Limiter = (*TokenBucket)(nil)
+	_ Limiter = (*LeakyBucket)(nil)
+	_ Limiter = (*GCRA)(nil)
+	_ Limiter = (*SlidingWindowLog)(nil)
+	_ Limiter = (*SlidingWindowCounter)(nil)
+	_ Limiter = (*FixedWindow)(nil)
+	_ Limiter = (*LeasedTokenBucket)(nil)
+	_ Limiter = (*FailSafe)(nil)
+)
+
+// wait implements Limiter.Wait on top of l.Reserve.
+func wait(ctx context.Context, l Limiter, amount int64) error {
+	for {
+		r, err := l.Reserve(ctx, amount)
+		if err != nil {
+			return err
+		}
+
+		result := r.Result()
+		if result.RetryAfter < 0 {
+			return ErrExceedsLimit
+		}
+
+		delay := r.Delay()
+		if !r.OK() {
+			delay = result.RetryAfter
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			if err := r.Cancel(ctx); err != nil {
+				return err
+			}
+			return ErrExceedsDeadline
+		}
+		if err := sleep(ctx, r.clock, delay); err != nil {
+			// Return the units back, regardless of whether ctx is done.
+			r.Cancel(context.Background())
+			return err
+		}
+
+		if r.OK() {
+			return nil
+		}
+	}
+}
+
+// sleep pauses the current goroutine for at least the duration d on clock,
+// or until ctx is done.
+func sleep(ctx context.Context, clock Clock, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	if _, ok := clock.(systemClock); ok {
+		return timer.Sleep(ctx, d)
+	}
+
+	select {
+	case <-clock.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// newUnsatisfiableResult returns the result for a request whose amount
+// exceeds the limit, which is rejected without consulting redis.
+func newUnsatisfiableResult(limit int64) Result {
+	return Result{Limit: limit, RetryAfter: -1}
+}
+
+// parseResult converts the reply of the algorithm operations, which are
+// executed at now, into a Result. All the operations reply with
+// {allowed, remaining, delay, retry_after, reset_after}, where the
+// durations are in microseconds.
+func parseResult(reply []int64, limit int64, now time.Time) (Result, error) {
+	if len(reply) != 5 {
+		return Result{}, fmt.Errorf("ratelimiter: unexpected reply %v", reply)
+	}
+	resetAfter := time.Duration(reply[4]) * time.Microsecond
+	return Result{
+		Allowed:    reply[0] == 1,
+		Limit:      limit,
+		Remaining:  reply[1],
+		Delay:      time.Duration(reply[2]) * time.Microsecond,
+		RetryAfter: time.Duration(reply[3]) * time.Microsecond,
+		ResetAfter: resetAfter,
+		ResetAt:    now.Add(resetAfter),
+	}, nil
+}
@@ -0,0 +1,138 @@
+package ratelimiter_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RussellLuo/ratelimiter"
+	"github.com/go-redis/redis"
+)
+
+func TestLimiter_Wait(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	key := "ratelimiter:limiter:test"
+	config := &ratelimiter.Config{
+		Interval: 1 * time.Second / 2,
+		Capacity: 5,
+	}
+	clock := ratelimiter.NewFakeClock(time.Now())
+
+	limiters := map[string]interface {
+		ratelimiter.Limiter
+		SetClock(ratelimiter.Clock)
+	}{
+		"tokenbucket":      ratelimiter.NewTokenBucket(&Redis{client}, key, config),
+		"leakybucket":      ratelimiter.NewLeakyBucket(&Redis{client}, key, config),
+		"gcra":             ratelimiter.NewGCRA(&Redis{client}, key, config),
+		"slidingwindowlog": ratelimiter.NewSlidingWindowLog(&Redis{client}, key, config),
+	}
+	for name, limiter := range limiters {
+		client.Del(key)
+		limiter.SetClock(clock)
+
+		done := make(chan error, 1)
+		go func() {
+			for i := 0; i < 6; i++ {
+				if err := limiter.Wait(context.Background(), 1); err != nil {
+					done <- err
+					return
+				}
+			}
+			done <- nil
+		}()
+
+		// Move the clock forward by a tenth of the interval whenever the
+		// limiter waits on it, until all the calls return.
+		start := clock.Now()
+	loop:
+		for {
+			select {
+			case err := <-done:
+				if err != nil {
+					t.Fatalf("%s: Err: %v", name, err)
+				}
+				break loop
+			default:
+				if clock.Waiters() > 0 {
+					clock.Advance(config.Interval / 10)
+				} else {
+					time.Sleep(time.Millisecond)
+				}
+			}
+		}
+		// The last one must wait for at least one interval.
+		if elapsed := clock.Now().Sub(start); elapsed < config.Interval {
+			t.Errorf("%s: Got elapsed (%v) < Want (%v)", name, elapsed, config.Interval)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		err := limiter.Wait(ctx, 5)
+		cancel()
+		if err != ratelimiter.ErrExceedsDeadline {
+			t.Errorf("%s: Got (%v) != Want (%v)", name, err, ratelimiter.ErrExceedsDeadline)
+		}
+
+		if err := limiter.Wait(context.Background(), 6); err != ratelimiter.ErrExceedsLimit {
+			t.Errorf("%s: Got (%v) != Want (%v)", name, err, ratelimiter.ErrExceedsLimit)
+		}
+	}
+}
+
+func TestLimiter_Reserve(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	key := "ratelimiter:limiter:test"
+	config := &ratelimiter.Config{
+		Interval: 1 * time.Second / 2,
+		Capacity: 5,
+	}
+
+	limiters := map[string]ratelimiter.Limiter{
+		"tokenbucket":      ratelimiter.NewTokenBucket(&Redis{client}, key, config),
+		"leakybucket":      ratelimiter.NewLeakyBucket(&Redis{client}, key, config),
+		"gcra":             ratelimiter.NewGCRA(&Redis{client}, key, config),
+		"slidingwindowlog": ratelimiter.NewSlidingWindowLog(&Redis{client}, key, config),
+	}
+	for name, limiter := range limiters {
+		client.Del(key)
+		ctx := context.Background()
+
+		r, err := limiter.Reserve(ctx, 5)
+		if err != nil {
+			t.Fatalf("%s: Err: %v", name, err)
+		}
+		if !r.OK() || r.Delay() != 0 {
+			t.Errorf("%s: Got (%v, %v) != Want (true, 0)", name, r.OK(), r.Delay())
+		}
+
+		r2, err := limiter.Reserve(ctx, 1)
+		if err != nil {
+			t.Fatalf("%s: Err: %v", name, err)
+		}
+		if r2.OK() || r2.Delay() != -1 {
+			t.Errorf("%s: Got (%v, %v) != Want (false, -1)", name, r2.OK(), r2.Delay())
+		}
+
+		// Cancelling twice must not return the units twice.
+		for i := 0; i < 2; i++ {
+			if err := r.Cancel(ctx); err != nil {
+				t.Fatalf("%s: Err: %v", name, err)
+			}
+		}
+
+		got, err := limiter.Allow(ctx, 5)
+		if err != nil {
+			t.Fatalf("%s: Err: %v", name, err)
+		}
+		if !got.Allowed || got.Delay != 0 {
+			t.Errorf("%s: Got (%#v) is not allowed immediately", name, got)
+		}
+		if got, _ := limiter.Allow(ctx, 1); got.Allowed && got.Delay == 0 {
+			t.Errorf("%s: Got (%#v) is allowed immediately", name, got)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package ratelimiter
+
+import (
+	"context"
+	"hash/fnv"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// the number of shards in Memory, which must be a power of two.
+const memoryShards = 256
+
+// Memory is an in-process Store, which applies the Go function of each
+// operation instead of the Lua script. It is useful for unit tests and
+// single-instance services, where a Redis server is unnecessary.
+//
+// Keys are spread over a number of shards, each of which is guarded by
+// its own lock, so that unrelated keys are not contended.
+type Memory struct {
+	shards [memoryShards]memoryShard
+	clock  Clock
+}
+
+// MemoryOption is an option for configuring Memory.
+type MemoryOption func(*Memory)
+
+// WithMemoryClock makes the store expire keys by clock instead of the
+// system clock, which should be the same clock as the limiters using
+// the store, e.g. a FakeClock in tests.
+func WithMemoryClock(clock Clock) MemoryOption {
+	return func(m *Memory) {
+		m.clock = clock
+	}
+}
+
+// NewMemory returns a new empty in-memory store.
+func NewMemory(opts ...MemoryOption) *Memory {
+	m := &Memory{clock: systemClock{}}
+	for i := range m.shards {
+		m.shards[i].items = make(map[string]memoryItem)
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Exec implements Store by applying the Go function of op, with the shards
+// of all the keys locked.
+func (m *Memory) Exec(ctx context.Context, op *Op, keys []string, args ...int64) ([]int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	indexes := m.shardIndexes(keys)
+	for _, i := range indexes {
+		m.shards[i].mu.Lock()
+	}
+	defer func() {
+		for _, i := range indexes {
+			m.shards[i].mu.Unlock()
+		}
+	}()
+
+	return op.Apply(&memoryTx{memory: m, now: m.clock.Now()}, keys, args)
+}
+
+// ExecBatch implements BatchStore by applying the Go functions of ops
+// in order, with the shards of all their keys locked.
+func (m *Memory) ExecBatch(ctx context.Context, ops []BatchOp) ([][]int64, error) {
+	return m.execBatch(ctx, ops, false)
+}
+
+// ExecAllOrNothing implements AllOrNothingStore by applying the Go functions
+// of ops like ExecBatch, and restoring the keys before returning unless
+// every operation is allowed.
+func (m *Memory) ExecAllOrNothing(ctx context.Context, ops []BatchOp) ([][]int64, error) {
+	return m.execBatch(ctx, ops, true)
+}
+
+func (m *Memory) execBatch(ctx context.Context, ops []BatchOp, allOrNothing bool) ([][]int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, o := range ops {
+		keys = append(keys, o.Keys...)
+	}
+	indexes := m.shardIndexes(keys)
+	for _, i := range indexes {
+		m.shards[i].mu.Lock()
+	}
+	defer func() {
+		for _, i := range indexes {
+			m.shards[i].mu.Unlock()
+		}
+	}()
+
+	var saved map[string]memoryItem
+	if allOrNothing {
+		saved = make(map[string]memoryItem, len(keys))
+		for _, key := range keys {
+			if _, ok := saved[key]; !ok {
+				saved[key] = m.shards[shardIndex(key)].items[key]
+			}
+		}
+	}
+
+	tx := &memoryTx{memory: m, now: m.clock.Now()}
+	replies := make([][]int64, len(ops))
+	for i, o := range ops {
+		reply, err := o.Op.Apply(tx, o.Keys, o.Args)
+		if err != nil {
+			return nil, err
+		}
+		replies[i] = reply
+	}
+
+	if allOrNothing && !admitted(replies) {
+		for key, item := range saved {
+			shard := &m.shards[shardIndex(key)]
+			if item.value == nil {
+				delete(shard.items, key)
+			} else {
+				shard.items[key] = item
+			}
+		}
+	}
+	return replies, nil
+}
+
+// shardIndexes returns the distinct indexes of the shards holding keys,
+// in ascending order, which is also the order to lock them in.
+func (m *Memory) shardIndexes(keys []string) []int {
+	seen := make(map[int]bool, len(keys))
+	indexes := make([]int, 0, len(keys))
+	for _, key := range keys {
+		i := shardIndex(key)
+		if !seen[i] {
+			seen[i] = true
+			indexes = append(indexes, i)
+		}
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+func shardIndex(key string) int {
+	h := fnv.New32a()
+	io.WriteString(h, key)
+	return int(h.Sum32() & (memoryShards - 1))
+}
+
+type memoryItem struct {
+	value    []byte
+	expireAt time.Time
+}
+
+type memoryShard struct {
+	mu     sync.Mutex
+	items  map[string]memoryItem
+	writes int
+}
+
+// sweep removes all the expired items from the shard, once the number of
+// writes since the last sweep reaches the number of items, which keeps
+// the amortized cost of each write constant.
+func (s *memoryShard) sweep(now time.Time) {
+	s.writes++
+	if s.writes < len(s.items) {
+		return
+	}
+	s.writes = 0
+
+	for key, item := range s.items {
+		if !item.expireAt.IsZero() && !now.Before(item.expireAt) {
+			delete(s.items, key)
+		}
+	}
+}
+
+// memoryTx implements Tx on the shards locked by Memory.Exec.
+type memoryTx struct {
+	memory *Memory
+	now    time.Time
+}
+
+func (tx *memoryTx) Get(key string) ([]byte, bool, error) {
+	shard := &tx.memory.shards[shardIndex(key)]
+	item, ok := shard.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if !item.expireAt.IsZero() && !tx.now.Before(item.expireAt) {
+		delete(shard.items, key)
+		return nil, false, nil
+	}
+	return item.value, true, nil
+}
+
+func (tx *memoryTx) Set(key string, value []byte, ttl time.Duration) error {
+	shard := &tx.memory.shards[shardIndex(key)]
+	item := memoryItem{value: value}
+	if ttl > 0 {
+		item.expireAt = tx.now.Add(ttl)
+	}
+	shard.items[key] = item
+	shard.sweep(tx.now)
+	return nil
+}
+
+func (tx *memoryTx) Del(key string) error {
+	delete(tx.memory.shards[shardIndex(key)].items, key)
+	return nil
+}
@@ -0,0 +1,28 @@
+package ratelimiter_test
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/RussellLuo/ratelimiter"
+)
+
+func BenchmarkMemory_Parallel(b *testing.B) {
+	memory := ratelimiter.NewMemory()
+	config := &ratelimiter.Config{
+		Interval: 1 * time.Second / 2,
+		Capacity: 5,
+	}
+
+	var id int64
+	b.RunParallel(func(pb *testing.PB) {
+		key := "ratelimiter:memory:benchmark:" + strconv.FormatInt(atomic.AddInt64(&id, 1), 10)
+		gcra := ratelimiter.NewGCRAWithStore(memory, key, config)
+		for pb.Next() {
+			gcra.Allow(context.Background(), 1)
+		}
+	})
+}
@@ -0,0 +1,123 @@
+package ratelimiter_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/RussellLuo/ratelimiter"
+)
+
+func TestMemory(t *testing.T) {
+	config := &ratelimiter.Config{
+		Interval: 1 * time.Second / 2,
+		Capacity: 5,
+	}
+	clock := ratelimiter.NewFakeClock(time.Now())
+
+	cases := []struct {
+		name    string
+		limiter interface {
+			ratelimiter.Limiter
+			SetClock(ratelimiter.Clock)
+		}
+		want []ratelimiter.Result
+	}{
+		{
+			name:    "tokenbucket",
+			limiter: ratelimiter.NewTokenBucketWithStore(ratelimiter.NewMemory(ratelimiter.WithMemoryClock(clock)), "key", config),
+			want: []ratelimiter.Result{
+				{Allowed: true, Limit: 5, Remaining: 2, ResetAfter: 1500 * time.Millisecond},
+				{Allowed: false, Limit: 5, Remaining: 2, RetryAfter: 500 * time.Millisecond, ResetAfter: 1500 * time.Millisecond},
+				{Allowed: true, Limit: 5, Remaining: 0, ResetAfter: 2500 * time.Millisecond},
+			},
+		},
+		{
+			name:    "leakybucket",
+			limiter: ratelimiter.NewLeakyBucketWithStore(ratelimiter.NewMemory(ratelimiter.WithMemoryClock(clock)), "key", config),
+			want: []ratelimiter.Result{
+				{Allowed: true, Limit: 5, Remaining: 2, ResetAfter: 1500 * time.Millisecond},
+				{Allowed: false, Limit: 5, Remaining: 2, RetryAfter: 500 * time.Millisecond, ResetAfter: 1500 * time.Millisecond},
+				{Allowed: true, Limit: 5, Remaining: 0, Delay: 1500 * time.Millisecond, ResetAfter: 2500 * time.Millisecond},
+			},
+		},
+		{
+			name:    "gcra",
+			limiter: ratelimiter.NewGCRAWithStore(ratelimiter.NewMemory(ratelimiter.WithMemoryClock(clock)), "key", config),
+			want: []ratelimiter.Result{
+				{Allowed: true, Limit: 5, Remaining: 2, ResetAfter: 1500 * time.Millisecond},
+				{Allowed: false, Limit: 5, Remaining: 2, RetryAfter: 500 * time.Millisecond, ResetAfter: 1500 * time.Millisecond},
+				{Allowed: true, Limit: 5, Remaining: 0, Delay: 1500 * time.Millisecond, ResetAfter: 2500 * time.Millisecond},
+			},
+		},
+		{
+			name:    "slidingwindowlog",
+			limiter: ratelimiter.NewSlidingWindowLogWithStore(ratelimiter.NewMemory(ratelimiter.WithMemoryClock(clock)), "key", config),
+			want: []ratelimiter.Result{
+				{Allowed: true, Limit: 5, Remaining: 2, ResetAfter: 500 * time.Millisecond},
+				{Allowed: false, Limit: 5, Remaining: 2, RetryAfter: 500 * time.Millisecond, ResetAfter: 500 * time.Millisecond},
+				{Allowed: true, Limit: 5, Remaining: 0, ResetAfter: 500 * time.Millisecond},
+			},
+		},
+	}
+	for _, c := range cases {
+		c.limiter.SetClock(clock)
+		for i, amount := range []int64{3, 3, 2} {
+			got, err := c.limiter.Allow(context.Background(), amount)
+			if err != nil {
+				t.Fatalf("%s: Err: %v", c.name, err)
+			}
+			want := c.want[i]
+			if !(got.Allowed == want.Allowed && got.Limit == want.Limit &&
+				got.Remaining == want.Remaining && got.Delay == want.Delay &&
+				got.RetryAfter == want.RetryAfter && got.ResetAfter == want.ResetAfter) {
+				t.Errorf("%s: Got (%#v) != Want (%#v)", c.name, got, want)
+			}
+		}
+
+		r, err := c.limiter.Reserve(context.Background(), 1)
+		if err != nil {
+			t.Fatalf("%s: Err: %v", c.name, err)
+		}
+		if r.OK() {
+			t.Errorf("%s: Got (%#v) is OK", c.name, r.Result())
+		}
+	}
+}
+
+func TestMemory_Concurrency(t *testing.T) {
+	memory := ratelimiter.NewMemory()
+	config := &ratelimiter.Config{
+		Interval: time.Hour,
+		Capacity: 100,
+	}
+
+	limiters := map[string]ratelimiter.Limiter{
+		"tokenbucket":          ratelimiter.NewTokenBucketWithStore(memory, "tokenbucket", config),
+		"leakybucket":          ratelimiter.NewLeakyBucketWithStore(memory, "leakybucket", config),
+		"gcra":                 ratelimiter.NewGCRAWithStore(memory, "gcra", config),
+		"slidingwindowlog":     ratelimiter.NewSlidingWindowLogWithStore(memory, "slidingwindowlog", config),
+		"slidingwindowcounter": ratelimiter.NewSlidingWindowCounterWithStore(memory, "slidingwindowcounter", config),
+		"fixedwindow":          ratelimiter.NewFixedWindowWithStore(memory, "fixedwindow", config),
+	}
+	for name, limiter := range limiters {
+		var passed int64
+		var wg sync.WaitGroup
+		for i := 0; i < 1000; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if r, _ := limiter.Allow(context.Background(), 1); r.Allowed {
+					atomic.AddInt64(&passed, 1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if passed != config.Capacity {
+			t.Errorf("%s: Got (%d) != Want (%d)", name, passed, config.Capacity)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package ratelimiter
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Period is the calendar period that a quota is reset in.
+type Period int
+
+const (
+	// Day is the period from one midnight to the next.
+	Day Period = iota + 1
+	// Week is the period from the midnight of one Monday to the next.
+	Week
+	// Month is the period from the midnight of the first day of one month
+	// to the next.
+	Month
+)
+
+// String returns the name of the period.
+func (p Period) String() string {
+	switch p {
+	case Day:
+		return "day"
+	case Week:
+		return "week"
+	case Month:
+		return "month"
+	default:
+		return "unknown"
+	}
+}
+
+// bounds returns the start and the end of the period containing t, in loc.
+func (p Period) bounds(t time.Time, loc *time.Location) (start, end time.Time) {
+	t = t.In(loc)
+	year, month, day := t.Date()
+	switch p {
+	case Week:
+		// Weeks start on Monday, as in ISO 8601.
+		day -= (int(t.Weekday()) + 6) % 7
+		start = time.Date(year, month, day, 0, 0, 0, 0, loc)
+		return start, start.AddDate(0, 0, 7)
+	case Month:
+		start = time.Date(year, month, 1, 0, 0, 0, 0, loc)
+		return start, start.AddDate(0, 1, 0)
+	default:
+		start = time.Date(year, month, day, 0, 0, 0, 0, loc)
+		return start, start.AddDate(0, 0, 1)
+	}
+}
+
+// the Lua script that returns the usage counted in a period.
+const luaQuotaUsage = `
+local key = KEYS[1]
+
+return {tonumber(redis.call("get", key) or "0")}
+`
+
+// quotaUsage is the Go function equivalent to luaQuotaUsage.
+func quotaUsage(tx Tx, keys []string, args []int64) ([]int64, error) {
+	value, ok, err := tx.Get(keys[0])
+	if err != nil || !ok {
+		return []int64{0}, err
+	}
+	var count int64
+	if err := decodeState(value, &count); err != nil {
+		return nil, err
+	}
+	return []int64{count}, nil
+}
+
+var quotaUsageOp = newOp("quota.usage", luaQuotaUsage, -1, quotaUsage)
+
+// QuotaConfig is the quota configuration.
+type QuotaConfig struct {
+	// Period is the calendar period that the usage is reset in.
+	Period Period
+
+	// Location is the time zone that the periods are aligned in.
+	// UTC is used if Location is nil.
+	Location *time.Location
+
+	// Limit is the number of units allowed in each period.
+	Limit int64
+
+	// Overage is the number of units allowed beyond Limit in each period,
+	// e.g. for billing the excess usage instead of rejecting it.
+	Overage int64
+}
+
+// Quota caps the usage of each key in calendar periods, like "100k API
+// calls per month", which is stored with the usage counter of each period
+// expiring automatically after the period ends.
+//
+// Unlike the rate limiters, a quota is shared by all the keys with the
+// same prefix, which are given in each call instead.
+type Quota struct {
+	baseClock
+	config *QuotaConfig
+
+	store  Store
+	prefix string
+}
+
+// NewQuota returns a new quota for the keys with prefix in redis with
+// the specified configuration.
+func NewQuota(redis Redis, prefix string, config *QuotaConfig) *Quota {
+	return NewQuotaWithStore(NewRedisStore(redis), prefix, config)
+}
+
+// NewQuotaWithStore returns a new quota for the keys with prefix in store with
+// the specified configuration.
+func NewQuotaWithStore(store Store, prefix string, config *QuotaConfig) *Quota {
+	return &Quota{
+		config: config,
+		store:  store,
+		prefix: prefix,
+	}
+}
+
+// Config returns the quota configuration in a concurrency-safe way.
+func (q *Quota) Config() QuotaConfig {
+	q.mu.RLock()
+	config := *q.config
+	q.mu.RUnlock()
+	return config
+}
+
+// SetConfig updates the quota configuration in a concurrency-safe way.
+func (q *Quota) SetConfig(config *QuotaConfig) {
+	q.mu.Lock()
+	q.config = config
+	q.mu.Unlock()
+}
+
+// Consume atomically counts amount units against the quota of key in the
+// current period, if the usage would not exceed Limit plus Overage.
+//
+// The returned Result.Limit is Limit, and Result.Remaining is the amount
+// that can still pass without going into overage.
+func (q *Quota) Consume(ctx context.Context, key string, amount int64) (Result, error) {
+	config := q.Config()
+	capacity := config.Limit + config.Overage
+	if amount > capacity {
+		return newUnsatisfiableResult(config.Limit), nil
+	}
+
+	now := q.Clock().Now()
+	start, end := config.Period.bounds(now, config.location())
+	result, err := q.store.Exec(
+		ctx,
+		fixedWindowOp,
+		[]string{q.periodKey(key, config.Period, start)},
+		capacity,
+		int64(time.Duration(now.UnixNano())/time.Microsecond),
+		amount,
+		int64(time.Duration(end.UnixNano())/time.Microsecond),
+	)
+	if err != nil {
+		return Result{}, err
+	}
+
+	r, err := parseResult(result, capacity, now)
+	if err != nil {
+		return Result{}, err
+	}
+	r.Limit = config.Limit
+	r.Remaining = maxInt64(r.Remaining-config.Overage, 0)
+	r.ResetAt = end
+	return r, nil
+}
+
+// Usage returns the number of units counted against the quota of key in
+// the current period, which may exceed Limit if Overage is allowed.
+func (q *Quota) Usage(ctx context.Context, key string) (int64, error) {
+	config := q.Config()
+	start, _ := config.Period.bounds(q.Clock().Now(), config.location())
+	result, err := q.store.Exec(ctx, quotaUsageOp, []string{q.periodKey(key, config.Period, start)})
+	if err != nil {
+		return 0, err
+	}
+	if len(result) != 1 {
+		return 0, fmt.Errorf("ratelimiter: unexpected reply %v", result)
+	}
+	return result[0], nil
+}
+
+// Remaining returns the number of units that can still be consumed by
+// key in the current period without going into overage.
+func (q *Quota) Remaining(ctx context.Context, key string) (int64, error) {
+	usage, err := q.Usage(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	return maxInt64(q.Config().Limit-usage, 0), nil
+}
+
+// periodKey returns the key of the usage counter of key in period
+// starting at start.
+func (q *Quota) periodKey(key string, period Period, start time.Time) string {
+	return q.prefix + ":" + key + ":" + period.String() + ":" + start.Format("20060102")
+}
+
+func (c QuotaConfig) location() *time.Location {
+	if c.Location == nil {
+		return time.UTC
+	}
+	return c.Location
+}
@@ -0,0 +1,156 @@
+package ratelimiter_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RussellLuo/ratelimiter"
+	"github.com/go-redis/redis"
+)
+
+func TestQuota_Consume(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	prefix := "ratelimiter:quota:test"
+	location := time.FixedZone("UTC-5", -5*60*60)
+	config := &ratelimiter.QuotaConfig{
+		Period:   ratelimiter.Month,
+		Location: location,
+		Limit:    5,
+		Overage:  2,
+	}
+
+	now := time.Now().In(location)
+	resetAt := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, location)
+
+	stores := map[string]ratelimiter.Store{
+		"redis":  ratelimiter.NewRedisStore(&Redis{client}),
+		"memory": ratelimiter.NewMemory(),
+	}
+	for name, store := range stores {
+		quota := ratelimiter.NewQuotaWithStore(store, prefix, config)
+		client.Del(prefix + ":tenant:month:" + time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, location).Format("20060102"))
+
+		cases := []struct {
+			amount    int64
+			want      ratelimiter.Result
+			wantUsage int64
+		}{
+			{
+				amount:    3,
+				want:      ratelimiter.Result{Allowed: true, Limit: 5, Remaining: 2},
+				wantUsage: 3,
+			},
+			// Go into overage.
+			{
+				amount:    3,
+				want:      ratelimiter.Result{Allowed: true, Limit: 5, Remaining: 0},
+				wantUsage: 6,
+			},
+			{
+				amount:    2,
+				want:      ratelimiter.Result{Allowed: false, Limit: 5, Remaining: 0},
+				wantUsage: 6,
+			},
+			{
+				amount:    1,
+				want:      ratelimiter.Result{Allowed: true, Limit: 5, Remaining: 0},
+				wantUsage: 7,
+			},
+			{
+				amount:    8,
+				want:      ratelimiter.Result{Allowed: false, Limit: 5, Remaining: 0, RetryAfter: -1},
+				wantUsage: 7,
+			},
+		}
+		for _, c := range cases {
+			got, err := quota.Consume(context.Background(), "tenant", c.amount)
+			if err != nil {
+				t.Fatalf("%s: Err: %v", name, err)
+			}
+			if !(got.Allowed == c.want.Allowed && got.Limit == c.want.Limit && got.Remaining == c.want.Remaining) {
+				t.Errorf("%s: Got (%#v) != Want (%#v)", name, got, c.want)
+			}
+			if c.want.RetryAfter == 0 && !got.ResetAt.Equal(resetAt) {
+				t.Errorf("%s: Got ResetAt (%v) != Want (%v)", name, got.ResetAt, resetAt)
+			}
+
+			usage, err := quota.Usage(context.Background(), "tenant")
+			if err != nil {
+				t.Fatalf("%s: Err: %v", name, err)
+			}
+			if usage != c.wantUsage {
+				t.Errorf("%s: Got usage (%d) != Want (%d)", name, usage, c.wantUsage)
+			}
+		}
+
+		remaining, err := quota.Remaining(context.Background(), "other")
+		if err != nil {
+			t.Fatalf("%s: Err: %v", name, err)
+		}
+		if remaining != config.Limit {
+			t.Errorf("%s: Got remaining (%d) != Want (%d)", name, remaining, config.Limit)
+		}
+	}
+}
+
+func TestQuota_Period(t *testing.T) {
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	daysToMonday := (7 - int(now.Weekday()) + 1) % 7
+	if daysToMonday == 0 {
+		daysToMonday = 7
+	}
+
+	cases := []struct {
+		period ratelimiter.Period
+		want   time.Time
+	}{
+		{period: ratelimiter.Day, want: today.AddDate(0, 0, 1)},
+		{period: ratelimiter.Week, want: today.AddDate(0, 0, daysToMonday)},
+		{period: ratelimiter.Month, want: time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		quota := ratelimiter.NewQuotaWithStore(ratelimiter.NewMemory(), "prefix", &ratelimiter.QuotaConfig{
+			Period: c.period,
+			Limit:  1,
+		})
+		got, err := quota.Consume(context.Background(), "key", 1)
+		if err != nil {
+			t.Fatalf("%v: Err: %v", c.period, err)
+		}
+		if !got.ResetAt.Equal(c.want) {
+			t.Errorf("%v: Got (%v) != Want (%v)", c.period, got.ResetAt, c.want)
+		}
+	}
+}
+
+func TestQuota_SetConfig(t *testing.T) {
+	// The first day of a month, which starts both a day and a month.
+	clock := ratelimiter.NewFakeClock(time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC))
+	quota := ratelimiter.NewQuotaWithStore(ratelimiter.NewMemory(ratelimiter.WithMemoryClock(clock)), "ratelimiter:quota:test", &ratelimiter.QuotaConfig{
+		Period: ratelimiter.Month,
+		Limit:  5,
+	})
+	quota.SetClock(clock)
+
+	ctx := context.Background()
+	if _, err := quota.Consume(ctx, "tenant", 3); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+
+	// The usage of the month is not inherited by the day.
+	quota.SetConfig(&ratelimiter.QuotaConfig{
+		Period: ratelimiter.Day,
+		Limit:  5,
+	})
+	usage, err := quota.Usage(ctx, "tenant")
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if usage != 0 {
+		t.Errorf("Got (%d) != Want (0)", usage)
+	}
+}
@@ -1,33 +1,21 @@
 package ratelimiter_test
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
 
 	"github.com/RussellLuo/ratelimiter"
-	"github.com/go-redis/redis"
+	"github.com/RussellLuo/ratelimiter/goredis"
+	"github.com/redis/go-redis/v9"
 )
 
-type Redis struct {
-	client *redis.Client
-}
-
-func (r *Redis) Eval(script string, keys []string, args ...interface{}) (interface{}, error) {
-	return r.client.Eval(script, keys, args...).Result()
-}
-
-func (r *Redis) EvalSha(sha1 string, keys []string, args ...interface{}) (interface{}, error, bool) {
-	result, err := r.client.EvalSha(sha1, keys, args...).Result()
-	noScript := err != nil && strings.HasPrefix(err.Error(), "NOSCRIPT ")
-	return result, err, noScript
-}
-
 func ExampleTokenBucket_Take() {
 	tb := ratelimiter.NewTokenBucket(
-		&Redis{redis.NewClient(&redis.Options{
+		goredis.New(redis.NewClient(&redis.Options{
 			Addr: "localhost:6379",
-		})},
+		})),
 		"ratelimiter:tokenbucket:example",
 		&ratelimiter.Config{
 			Interval: 1 * time.Second / 2,
@@ -48,9 +36,9 @@ func ExampleTokenBucket_Take() {
 
 func ExampleLeakyBucket_Give() {
 	lb := ratelimiter.NewLeakyBucket(
-		&Redis{redis.NewClient(&redis.Options{
+		goredis.New(redis.NewClient(&redis.Options{
 			Addr: "localhost:6379",
-		})},
+		})),
 		"ratelimiter:leakybucket:example",
 		&ratelimiter.Config{
 			Interval: 1 * time.Second / 2,
@@ -75,9 +63,9 @@ func ExampleLeakyBucket_Give() {
 
 func ExampleGCRA_Transmit() {
 	gcra := ratelimiter.NewGCRA(
-		&Redis{redis.NewClient(&redis.Options{
+		goredis.New(redis.NewClient(&redis.Options{
 			Addr: "localhost:6379",
-		})},
+		})),
 		"ratelimiter:gcra:example",
 		&ratelimiter.Config{
 			Interval: 1 * time.Second / 2,
@@ -98,4 +86,270 @@ func ExampleGCRA_Transmit() {
 	}
 	// Output:
 	// PASS
-}
\ No newline at end of file
+}
+
+func ExampleLimiter() {
+	store := ratelimiter.NewRedisStore(goredis.New(redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})))
+	config := &ratelimiter.Config{
+		Interval: 1 * time.Second / 2,
+		Capacity: 5,
+	}
+
+	// The algorithm is chosen by configuration, while the call site stays the same.
+	var limiter ratelimiter.Limiter
+	switch algorithm := "gcra"; algorithm {
+	case "tokenbucket":
+		limiter = ratelimiter.NewTokenBucketWithStore(store, "ratelimiter:limiter:example", config)
+	case "leakybucket":
+		limiter = ratelimiter.NewLeakyBucketWithStore(store, "ratelimiter:limiter:example", config)
+	default:
+		limiter = ratelimiter.NewGCRAWithStore(store, "ratelimiter:limiter:example", config)
+	}
+
+	if r, err := limiter.Allow(context.Background(), 1); r.Allowed {
+		fmt.Println("PASS")
+	} else {
+		if err != nil {
+			fmt.Println(err.Error())
+		}
+		fmt.Println("DROP")
+	}
+	// Output:
+	// PASS
+}
+
+func ExampleSlidingWindowLog_Allow() {
+	log := ratelimiter.NewSlidingWindowLog(
+		goredis.New(redis.NewClient(&redis.Options{
+			Addr: "localhost:6379",
+		})),
+		"ratelimiter:slidingwindowlog:example",
+		&ratelimiter.Config{
+			// At most 5 requests in any second.
+			Interval: 1 * time.Second,
+			Capacity: 5,
+		},
+	)
+	if r, err := log.Allow(context.Background(), 1); r.Allowed {
+		fmt.Println("PASS")
+	} else {
+		if err != nil {
+			fmt.Println(err.Error())
+		}
+		fmt.Println("DROP")
+	}
+	// Output:
+	// PASS
+}
+
+func ExampleSlidingWindowCounter_Allow() {
+	counter := ratelimiter.NewSlidingWindowCounter(
+		goredis.New(redis.NewClient(&redis.Options{
+			Addr: "localhost:6379",
+		})),
+		"ratelimiter:slidingwindowcounter:example",
+		&ratelimiter.Config{
+			Interval: 1 * time.Second,
+			Capacity: 5,
+		},
+	)
+	if r, err := counter.Allow(context.Background(), 1); r.Allowed {
+		fmt.Println("PASS")
+	} else {
+		if err != nil {
+			fmt.Println(err.Error())
+		}
+		fmt.Println("DROP")
+	}
+	// Output:
+	// PASS
+}
+
+func ExampleFixedWindow_Allow() {
+	location, _ := time.LoadLocation("Asia/Shanghai")
+	window := ratelimiter.NewFixedWindow(
+		goredis.New(redis.NewClient(&redis.Options{
+			Addr: "localhost:6379",
+		})),
+		"ratelimiter:fixedwindow:example",
+		&ratelimiter.Config{
+			// At most 1000 requests per calendar day in Asia/Shanghai.
+			Interval: 24 * time.Hour,
+			Capacity: 1000,
+			Location: location,
+		},
+	)
+	if r, err := window.Allow(context.Background(), 1); r.Allowed {
+		fmt.Println("PASS")
+	} else {
+		if err != nil {
+			fmt.Println(err.Error())
+		}
+		fmt.Println("DROP")
+	}
+	// Output:
+	// PASS
+}
+
+func ExampleConcurrencyLimiter_Acquire() {
+	limiter := ratelimiter.NewConcurrencyLimiter(
+		goredis.New(redis.NewClient(&redis.Options{
+			Addr: "localhost:6379",
+		})),
+		"ratelimiter:concurrency:example",
+		&ratelimiter.Config{
+			// At most 5 jobs in flight, each of which must renew its lease
+			// within 30 seconds.
+			Interval: 30 * time.Second,
+			Capacity: 5,
+		},
+	)
+
+	ctx := context.Background()
+	lease, err := limiter.Acquire(ctx)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	if !lease.OK() {
+		fmt.Println("DROP")
+		return
+	}
+	defer lease.Release(ctx)
+
+	// Do the job, renewing the lease periodically if it takes long.
+	fmt.Println("PASS")
+	// Output:
+	// PASS
+}
+
+func ExampleQuota_Consume() {
+	quota := ratelimiter.NewQuota(
+		goredis.New(redis.NewClient(&redis.Options{
+			Addr: "localhost:6379",
+		})),
+		"ratelimiter:quota:example",
+		&ratelimiter.QuotaConfig{
+			// 100k API calls per calendar month in UTC, with 10k more
+			// calls allowed as overage.
+			Period:  ratelimiter.Month,
+			Limit:   100000,
+			Overage: 10000,
+		},
+	)
+	if r, err := quota.Consume(context.Background(), "customer", 1); r.Allowed {
+		fmt.Println("PASS")
+	} else {
+		if err != nil {
+			fmt.Println(err.Error())
+		}
+		fmt.Println("DROP")
+	}
+	// Output:
+	// PASS
+}
+
+func ExampleKeyedLimiter() {
+	limiter := ratelimiter.NewKeyedLimiter(
+		goredis.New(redis.NewClient(&redis.Options{
+			Addr: "localhost:6379",
+		})),
+		"ratelimiter:keyed:example",
+		ratelimiter.AlgorithmGCRA,
+		&ratelimiter.Config{
+			Interval: 1 * time.Second / 2,
+			Capacity: 5,
+		},
+	)
+	// Paid users get a larger burst.
+	limiter.SetConfigFunc(func(key string) *ratelimiter.Config {
+		if strings.HasPrefix(key, "paid:") {
+			return &ratelimiter.Config{Interval: 1 * time.Second / 2, Capacity: 50}
+		}
+		return nil
+	})
+
+	if r, err := limiter.Allow(context.Background(), "paid:42", 1); r.Allowed {
+		fmt.Println("PASS")
+	} else {
+		if err != nil {
+			fmt.Println(err.Error())
+		}
+		fmt.Println("DROP")
+	}
+	// Output:
+	// PASS
+}
+
+func ExampleLeasedTokenBucket() {
+	client := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	client.Del(context.Background(), "ratelimiter:leasedtokenbucket:example")
+
+	bucket := ratelimiter.NewLeasedTokenBucket(
+		ratelimiter.NewTokenBucket(
+			goredis.New(client),
+			"ratelimiter:leasedtokenbucket:example",
+			&ratelimiter.Config{
+				Interval: 1 * time.Second / 1000,
+				Capacity: 1000,
+			},
+		),
+		// Lease 50 tokens per round trip, and return the unused ones
+		// after 100ms.
+		&ratelimiter.LeaseConfig{
+			Size: 50,
+			TTL:  100 * time.Millisecond,
+		},
+	)
+	defer bucket.Flush(context.Background())
+
+	for i := 0; i < 100; i++ {
+		if ok, err := bucket.Take(1); !ok {
+			if err != nil {
+				fmt.Println(err.Error())
+			}
+			fmt.Println("DROP")
+			return
+		}
+	}
+	fmt.Println("PASS")
+	fmt.Println(bucket.Stats().Leases)
+	// Output:
+	// PASS
+	// 2
+}
+
+func ExampleAllowBatch() {
+	store := ratelimiter.NewRedisStore(goredis.New(redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})))
+	user := ratelimiter.NewTokenBucketWithStore(store, "ratelimiter:batch:example:user:42", &ratelimiter.Config{
+		Interval: 1 * time.Second / 10,
+		Capacity: 10,
+	})
+	org := ratelimiter.NewTokenBucketWithStore(store, "ratelimiter:batch:example:org:7", &ratelimiter.Config{
+		Interval: 1 * time.Second / 100,
+		Capacity: 100,
+	})
+
+	// Both limits are checked in one round trip.
+	results, err := ratelimiter.AllowBatch(context.Background(),
+		ratelimiter.Check{Limiter: user, Amount: 1},
+		ratelimiter.Check{Limiter: org, Amount: 1},
+	)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	if results[0].Allowed && results[1].Allowed {
+		fmt.Println("PASS")
+	} else {
+		fmt.Println("DROP")
+	}
+	// Output:
+	// PASS
+}
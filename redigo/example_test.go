@@ -0,0 +1,24 @@
+package redigo_test
+
+import (
+	"time"
+
+	"github.com/RussellLuo/ratelimiter"
+	"github.com/RussellLuo/ratelimiter/redigo"
+	"github.com/gomodule/redigo/redis"
+)
+
+func ExampleNew() {
+	pool := &redis.Pool{
+		MaxIdle: 10,
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", "localhost:6379")
+		},
+	}
+
+	bucket := ratelimiter.NewTokenBucket(redigo.New(pool), "user:42", &ratelimiter.Config{
+		Interval: 1 * time.Second / 10,
+		Capacity: 20,
+	})
+	_ = bucket
+}
@@ -0,0 +1,99 @@
+// Package redigo adapts the connection pools of redigo to the Redis
+// interface of package ratelimiter.
+package redigo
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/RussellLuo/ratelimiter"
+	"github.com/gomodule/redigo/redis"
+)
+
+var (
+	_ ratelimiter.ContextRedis = (*Redis)(nil)
+	_ ratelimiter.ScriptLoader = (*Redis)(nil)
+)
+
+// Redis implements ratelimiter.Redis on top of a connection pool of redigo.
+type Redis struct {
+	pool *redis.Pool
+}
+
+// New returns a new adapter of pool.
+func New(pool *redis.Pool) *Redis {
+	return &Redis{pool: pool}
+}
+
+// Eval runs the Lua script src.
+func (r *Redis) Eval(src string, keys []string, args ...interface{}) (interface{}, error) {
+	return r.EvalContext(context.Background(), src, keys, args...)
+}
+
+// EvalSha runs the Lua script cached by its SHA1 digest. The returned bool
+// reports whether the script is not cached, i.e. the error is NOSCRIPT.
+func (r *Redis) EvalSha(sha1 string, keys []string, args ...interface{}) (interface{}, error, bool) {
+	return r.EvalShaContext(context.Background(), sha1, keys, args...)
+}
+
+// EvalContext is like Eval but honors the cancellation and deadline of ctx.
+func (r *Redis) EvalContext(ctx context.Context, src string, keys []string, args ...interface{}) (interface{}, error) {
+	return r.do(ctx, "EVAL", src, keys, args)
+}
+
+// EvalShaContext is like EvalSha but honors the cancellation and deadline of ctx.
+func (r *Redis) EvalShaContext(ctx context.Context, sha1 string, keys []string, args ...interface{}) (interface{}, error, bool) {
+	result, err := r.do(ctx, "EVALSHA", sha1, keys, args)
+	var redisErr redis.Error
+	noScript := errors.As(err, &redisErr) && strings.HasPrefix(string(redisErr), "NOSCRIPT")
+	return result, err, noScript
+}
+
+// ScriptLoad loads the Lua script src.
+func (r *Redis) ScriptLoad(src string) (string, error) {
+	conn := r.pool.Get()
+	defer conn.Close()
+	return redis.String(conn.Do("SCRIPT", "LOAD", src))
+}
+
+// do runs the script command cmd with script, which is either the source
+// or the SHA1 digest of the script, on a connection of the pool.
+func (r *Redis) do(ctx context.Context, cmd, script string, keys []string, args []interface{}) (interface{}, error) {
+	conn, err := r.pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	values := make([]interface{}, 0, 2+len(keys)+len(args))
+	values = append(values, script, len(keys))
+	for _, key := range keys {
+		values = append(values, key)
+	}
+	values = append(values, args...)
+
+	result, err := redis.DoContext(conn, ctx, cmd, values...)
+	if err != nil {
+		return nil, err
+	}
+	return convert(result), nil
+}
+
+// convert converts the result of a script into the types expected by
+// package ratelimiter, i.e. int64 for integers, []interface{} for arrays
+// and string for bulk strings.
+func convert(v interface{}) interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		for i, e := range v {
+			values[i] = convert(e)
+		}
+		return values
+	case []byte:
+		return string(v)
+	default:
+		return v
+	}
+}
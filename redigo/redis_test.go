@@ -0,0 +1,97 @@
+package redigo_test
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/RussellLuo/ratelimiter"
+	"github.com/RussellLuo/ratelimiter/redigo"
+	"github.com/gomodule/redigo/redis"
+)
+
+func newPool() *redis.Pool {
+	return &redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", "localhost:6379")
+		},
+	}
+}
+
+func TestRedis(t *testing.T) {
+	pool := newPool()
+	r := redigo.New(pool)
+	ctx := context.Background()
+
+	src := `return {1, "a", {2, 3}}`
+	want := []interface{}{int64(1), "a", []interface{}{int64(2), int64(3)}}
+
+	// The script is not cached yet.
+	pool.Get().Do("SCRIPT", "FLUSH")
+	_, err, noScript := r.EvalShaContext(ctx, fmt.Sprintf("%x", sha1.Sum([]byte(src))), nil)
+	if err == nil || !noScript {
+		t.Fatalf("Got (%v, %v) != Want (NOSCRIPT, true)", err, noScript)
+	}
+
+	got, err := r.EvalContext(ctx, src, nil)
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got (%#v) != Want (%#v)", got, want)
+	}
+
+	hash, err := r.ScriptLoad(src)
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	got, err, noScript = r.EvalShaContext(ctx, hash, nil)
+	if err != nil || noScript {
+		t.Fatalf("Err: %v, NOSCRIPT: %v", err, noScript)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got (%#v) != Want (%#v)", got, want)
+	}
+
+	// Other errors are not NOSCRIPT.
+	failing, err := r.ScriptLoad(`return redis.error_reply("ERR failing")`)
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if _, err, noScript := r.EvalShaContext(ctx, failing, nil); err == nil || noScript {
+		t.Errorf("Got (%v, %v) != Want (error, false)", err, noScript)
+	}
+
+	// The context is propagated.
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := r.EvalContext(cancelled, src, nil); err == nil {
+		t.Errorf("Got no error with a cancelled context")
+	}
+}
+
+func TestRedis_Limiter(t *testing.T) {
+	pool := newPool()
+	key := "ratelimiter:redigo:test"
+	conn := pool.Get()
+	conn.Do("DEL", key)
+	conn.Do("SCRIPT", "FLUSH")
+	conn.Close()
+
+	bucket := ratelimiter.NewTokenBucket(redigo.New(pool), key, &ratelimiter.Config{
+		Interval: time.Second,
+		Capacity: 2,
+	})
+	for i, want := range []bool{true, true, false} {
+		r, err := bucket.Allow(context.Background(), 1)
+		if err != nil {
+			t.Fatalf("#%d: Err: %v", i, err)
+		}
+		if r.Allowed != want {
+			t.Errorf("#%d: Got (%v) != Want (%v)", i, r.Allowed, want)
+		}
+	}
+}
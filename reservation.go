@@ -0,0 +1,74 @@
+package ratelimiter
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Reservation holds the information about amount units reserved by
+// a limiter, which may be returned back by calling Cancel.
+type Reservation struct {
+	result   Result
+	clock    Clock
+	reserved time.Time
+	refund   func(ctx context.Context) error
+
+	mu        sync.Mutex
+	cancelled bool
+}
+
+func newReservation(result Result, clock Clock, refund func(ctx context.Context) error) *Reservation {
+	return &Reservation{
+		result:   result,
+		clock:    clock,
+		reserved: clock.Now(),
+		refund:   refund,
+	}
+}
+
+// OK reports whether the limiter granted the reservation.
+func (r *Reservation) OK() bool {
+	return r.result.Allowed
+}
+
+// Result returns the result of the reservation.
+func (r *Reservation) Result() Result {
+	return r.result
+}
+
+// Delay returns the duration the reservation holder must wait before
+// performing the reserved action. It returns -1 if the reservation is not OK.
+func (r *Reservation) Delay() time.Duration {
+	if !r.OK() {
+		return -1
+	}
+	if delay := r.result.Delay - r.clock.Now().Sub(r.reserved); delay > 0 {
+		return delay
+	}
+	return 0
+}
+
+// Cancel indicates that the reservation holder will not perform the reserved
+// action, and returns the reserved units back to the limiter as much as possible.
+//
+// Cancel is a no-op if the reservation is not OK, has already been cancelled,
+// or has outlived the reset time of the limiter (see Result.ResetAfter), after
+// which returning the units would grant capacity that was never reserved.
+func (r *Reservation) Cancel(ctx context.Context) error {
+	if !r.OK() {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cancelled || r.clock.Now().Sub(r.reserved) >= r.result.ResetAfter {
+		return nil
+	}
+	if err := r.refund(ctx); err != nil {
+		return err
+	}
+	r.cancelled = true
+	return nil
+}
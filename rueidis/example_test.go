@@ -0,0 +1,25 @@
+package rueidis_test
+
+import (
+	"time"
+
+	"github.com/RussellLuo/ratelimiter"
+	ratelimiterrueidis "github.com/RussellLuo/ratelimiter/rueidis"
+	"github.com/redis/rueidis"
+)
+
+func ExampleNew() {
+	client, err := rueidis.NewClient(rueidis.ClientOption{
+		InitAddress: []string{"localhost:6379"},
+	})
+	if err != nil {
+		panic(err)
+	}
+	defer client.Close()
+
+	bucket := ratelimiter.NewTokenBucket(ratelimiterrueidis.New(client), "user:42", &ratelimiter.Config{
+		Interval: 1 * time.Second / 10,
+		Capacity: 20,
+	})
+	_ = bucket
+}
@@ -0,0 +1,123 @@
+// Package rueidis adapts the clients of rueidis to the Redis interface
+// of package ratelimiter.
+package rueidis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/RussellLuo/ratelimiter"
+	"github.com/redis/rueidis"
+)
+
+var (
+	_ ratelimiter.ContextRedis = (*Redis)(nil)
+	_ ratelimiter.ScriptLoader = (*Redis)(nil)
+)
+
+// Redis implements ratelimiter.Redis on top of a client of rueidis, which
+// may be connected to a standalone Redis or to a Redis Cluster.
+type Redis struct {
+	client rueidis.Client
+}
+
+// New returns a new adapter of client.
+func New(client rueidis.Client) *Redis {
+	return &Redis{client: client}
+}
+
+// Eval runs the Lua script src.
+func (r *Redis) Eval(src string, keys []string, args ...interface{}) (interface{}, error) {
+	return r.EvalContext(context.Background(), src, keys, args...)
+}
+
+// EvalSha runs the Lua script cached by its SHA1 digest. The returned bool
+// reports whether the script is not cached, i.e. the error is NOSCRIPT.
+func (r *Redis) EvalSha(sha1 string, keys []string, args ...interface{}) (interface{}, error, bool) {
+	return r.EvalShaContext(context.Background(), sha1, keys, args...)
+}
+
+// EvalContext is like Eval but honors the cancellation and deadline of ctx.
+func (r *Redis) EvalContext(ctx context.Context, src string, keys []string, args ...interface{}) (interface{}, error) {
+	cmd := r.client.B().Eval().Script(src).Numkeys(int64(len(keys))).Key(keys...).Arg(formatArgs(args)...).Build()
+	return reply(r.client.Do(ctx, cmd))
+}
+
+// EvalShaContext is like EvalSha but honors the cancellation and deadline of ctx.
+func (r *Redis) EvalShaContext(ctx context.Context, sha1 string, keys []string, args ...interface{}) (interface{}, error, bool) {
+	cmd := r.client.B().Evalsha().Sha1(sha1).Numkeys(int64(len(keys))).Key(keys...).Arg(formatArgs(args)...).Build()
+	result, err := reply(r.client.Do(ctx, cmd))
+	redisErr, ok := rueidis.IsRedisErr(err)
+	return result, err, ok && redisErr.IsNoScript()
+}
+
+// ScriptLoad loads the Lua script src on every node the client knows.
+func (r *Redis) ScriptLoad(src string) (string, error) {
+	var sha1 string
+	for _, node := range r.client.Nodes() {
+		hash, err := node.Do(context.Background(), node.B().ScriptLoad().Script(src).Build()).ToString()
+		if err != nil {
+			return "", err
+		}
+		sha1 = hash
+	}
+	return sha1, nil
+}
+
+// formatArgs formats the arguments of a script, which are all integers or
+// strings in package ratelimiter.
+func formatArgs(args []interface{}) []string {
+	values := make([]string, len(args))
+	for i, arg := range args {
+		switch arg := arg.(type) {
+		case int64:
+			values[i] = strconv.FormatInt(arg, 10)
+		case int:
+			values[i] = strconv.Itoa(arg)
+		case string:
+			values[i] = arg
+		default:
+			values[i] = fmt.Sprint(arg)
+		}
+	}
+	return values
+}
+
+// reply converts the result of a script into the types expected by package
+// ratelimiter, i.e. int64 for integers, []interface{} for arrays and string
+// for bulk strings.
+func reply(result rueidis.RedisResult) (interface{}, error) {
+	msg, err := result.ToMessage()
+	if rueidis.IsRedisNil(err) {
+		// The script returned nil.
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return convert(msg)
+}
+
+func convert(msg rueidis.RedisMessage) (interface{}, error) {
+	switch {
+	case msg.IsNil():
+		return nil, nil
+	case msg.IsInt64():
+		return msg.ToInt64()
+	case msg.IsArray():
+		elems, err := msg.ToArray()
+		if err != nil {
+			return nil, err
+		}
+		values := make([]interface{}, len(elems))
+		for i, e := range elems {
+			if values[i], err = convert(e); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	default:
+		return msg.ToAny()
+	}
+}
@@ -0,0 +1,100 @@
+package rueidis_test
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/RussellLuo/ratelimiter"
+	ratelimiterrueidis "github.com/RussellLuo/ratelimiter/rueidis"
+	"github.com/redis/rueidis"
+)
+
+func newClient(t *testing.T) rueidis.Client {
+	client, err := rueidis.NewClient(rueidis.ClientOption{
+		InitAddress:  []string{"localhost:6379"},
+		DisableCache: true,
+	})
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	return client
+}
+
+func TestRedis(t *testing.T) {
+	client := newClient(t)
+	defer client.Close()
+	r := ratelimiterrueidis.New(client)
+	ctx := context.Background()
+
+	src := `return {1, "a", {2, 3}}`
+	want := []interface{}{int64(1), "a", []interface{}{int64(2), int64(3)}}
+
+	// The script is not cached yet.
+	client.Do(ctx, client.B().ScriptFlush().Build())
+	_, err, noScript := r.EvalShaContext(ctx, fmt.Sprintf("%x", sha1.Sum([]byte(src))), nil)
+	if err == nil || !noScript {
+		t.Fatalf("Got (%v, %v) != Want (NOSCRIPT, true)", err, noScript)
+	}
+
+	got, err := r.EvalContext(ctx, src, nil)
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got (%#v) != Want (%#v)", got, want)
+	}
+
+	hash, err := r.ScriptLoad(src)
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	got, err, noScript = r.EvalShaContext(ctx, hash, nil)
+	if err != nil || noScript {
+		t.Fatalf("Err: %v, NOSCRIPT: %v", err, noScript)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got (%#v) != Want (%#v)", got, want)
+	}
+
+	// Other errors are not NOSCRIPT.
+	failing, err := r.ScriptLoad(`return redis.error_reply("ERR failing")`)
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if _, err, noScript := r.EvalShaContext(ctx, failing, nil); err == nil || noScript {
+		t.Errorf("Got (%v, %v) != Want (error, false)", err, noScript)
+	}
+
+	// The context is propagated.
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := r.EvalContext(cancelled, src, nil); err == nil {
+		t.Errorf("Got no error with a cancelled context")
+	}
+}
+
+func TestRedis_Limiter(t *testing.T) {
+	client := newClient(t)
+	defer client.Close()
+	key := "ratelimiter:rueidis:test"
+	client.Do(context.Background(), client.B().Del().Key(key).Build())
+	client.Do(context.Background(), client.B().ScriptFlush().Build())
+
+	bucket := ratelimiter.NewTokenBucket(ratelimiterrueidis.New(client), key, &ratelimiter.Config{
+		Interval: time.Second,
+		Capacity: 2,
+	})
+	for i, want := range []bool{true, true, false} {
+		r, err := bucket.Allow(context.Background(), 1)
+		if err != nil {
+			t.Fatalf("#%d: Err: %v", i, err)
+		}
+		if r.Allowed != want {
+			t.Errorf("#%d: Got (%v) != Want (%v)", i, r.Allowed, want)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package ratelimiter
 
 import (
+	"context"
 	"crypto/sha1"
 	"encoding/hex"
 	"io"
@@ -11,6 +12,22 @@ type Redis interface {
 	EvalSha(sha1 string, keys []string, args ...interface{}) (interface{}, error, bool)
 }
 
+// ContextRedis is an optional interface that can be implemented by a Redis
+// to support cancellation and deadlines of the underlying commands.
+type ContextRedis interface {
+	Redis
+
+	EvalContext(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error)
+	EvalShaContext(ctx context.Context, sha1 string, keys []string, args ...interface{}) (interface{}, error, bool)
+}
+
+// ScriptLoader is an optional interface that can be implemented by a Redis
+// to load scripts ahead of time (see RedisStore.LoadScripts), which should
+// load them on every node of a cluster, e.g. redis.ClusterClient.ScriptLoad.
+type ScriptLoader interface {
+	ScriptLoad(script string) (string, error)
+}
+
 type Script struct {
 	redis Redis
 	src   string
@@ -18,19 +35,72 @@ type Script struct {
 }
 
 func NewScript(redis Redis, src string) *Script {
-	h := sha1.New()
-	io.WriteString(h, src)
 	return &Script{
 		redis: redis,
 		src:   src,
-		hash:  hex.EncodeToString(h.Sum(nil)),
+		hash:  scriptHash(src),
 	}
 }
 
 func (s *Script) Run(keys []string, args ...interface{}) (interface{}, error) {
+	return s.RunContext(context.Background(), keys, args...)
+}
+
+// RunContext is like Run but honors the cancellation and deadline of ctx.
+//
+// If the underlying Redis implements ContextRedis, ctx is passed through.
+// Otherwise the script is run in a separate goroutine, and RunContext
+// stops waiting for it once ctx is done.
+func (s *Script) RunContext(ctx context.Context, keys []string, args ...interface{}) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, ok := s.redis.(ContextRedis); ok {
+		result, err := s.run(ctx, keys, args...)
+		if err != nil && ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return result, err
+	}
+
+	type reply struct {
+		result interface{}
+		err    error
+	}
+	c := make(chan reply, 1)
+	go func() {
+		result, err := s.run(ctx, keys, args...)
+		c <- reply{result: result, err: err}
+	}()
+
+	select {
+	case r := <-c:
+		return r.result, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (s *Script) run(ctx context.Context, keys []string, args ...interface{}) (interface{}, error) {
+	if r, ok := s.redis.(ContextRedis); ok {
+		result, err, noScript := r.EvalShaContext(ctx, s.hash, keys, args...)
+		if noScript {
+			result, err = r.EvalContext(ctx, s.src, keys, args...)
+		}
+		return result, err
+	}
+
 	result, err, noScript := s.redis.EvalSha(s.hash, keys, args...)
 	if noScript {
 		result, err = s.redis.Eval(s.src, keys, args...)
 	}
 	return result, err
 }
+
+// scriptHash returns the SHA1 digest of the script src in hex.
+func scriptHash(src string) string {
+	h := sha1.New()
+	io.WriteString(h, src)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,75 @@
+package ratelimiter_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RussellLuo/ratelimiter"
+)
+
+// hungRedis simulates a redis server that never responds.
+type hungRedis struct {
+	done chan struct{}
+}
+
+func (r *hungRedis) Eval(script string, keys []string, args ...interface{}) (interface{}, error) {
+	<-r.done
+	return nil, nil
+}
+
+func (r *hungRedis) EvalSha(sha1 string, keys []string, args ...interface{}) (interface{}, error, bool) {
+	<-r.done
+	return nil, nil, false
+}
+
+// hungContextRedis is like hungRedis, but respects the context.
+type hungContextRedis struct {
+	hungRedis
+}
+
+func (r *hungContextRedis) EvalContext(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (r *hungContextRedis) EvalShaContext(ctx context.Context, sha1 string, keys []string, args ...interface{}) (interface{}, error, bool) {
+	<-ctx.Done()
+	return nil, ctx.Err(), false
+}
+
+func TestScript_RunContext(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	cases := []struct {
+		name  string
+		redis ratelimiter.Redis
+	}{
+		{
+			name:  "redis",
+			redis: &hungRedis{done: done},
+		},
+		{
+			name:  "context redis",
+			redis: &hungContextRedis{hungRedis{done: done}},
+		},
+	}
+	for _, c := range cases {
+		script := ratelimiter.NewScript(c.redis, "return 1")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		_, err := script.RunContext(ctx, []string{"key"})
+		cancel()
+		if err != context.DeadlineExceeded {
+			t.Errorf("%s: Got (%v) != Want (%v)", c.name, err, context.DeadlineExceeded)
+		}
+
+		ctx, cancel = context.WithCancel(context.Background())
+		cancel()
+		_, err = script.RunContext(ctx, []string{"key"})
+		if err != context.Canceled {
+			t.Errorf("%s: Got (%v) != Want (%v)", c.name, err, context.Canceled)
+		}
+	}
+}
@@ -0,0 +1,301 @@
+package ratelimiter
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// the Lua script that implements the Sliding Window Counter Algorithm.
+// counter.ws represents the start timestamp of the current window,
+// counter.pc represents the count of the previous window,
+// counter.cc represents the count of the current window.
+const luaSlidingWindowCounter = luaClock + `
+local key = KEYS[1]
+local window = tonumber(ARGV[1])
+local capacity = tonumber(ARGV[2])
+local now = clock(tonumber(ARGV[3]))
+local amount = tonumber(ARGV[4])
+
+local start = now - now % window
+local counter = {ws=start, pc=0, cc=0}
+local value = redis.call("get", key)
+if value then
+  local last = cjson.decode(value)
+  last.ws = tonumber(last.ws)
+  if last.ws == start then
+    counter = last
+  elseif last.ws == start - window then
+    counter.pc = last.cc
+  end
+end
+
+local elapsed = now - start
+local estimated = counter.pc * (window - elapsed) / window + counter.cc
+
+local allowed = 0
+local retry_after = 0
+if estimated + amount <= capacity then
+  counter.cc = counter.cc + amount
+  estimated = estimated + amount
+  local ttl = math.ceil((start + 2 * window - now) / 1000)
+  redis.call("set", key, cjson.encode({ws=string.format("%.f", start), pc=counter.pc, cc=counter.cc}), "px", ttl)
+  allowed = 1
+else
+  local room = capacity - counter.cc - amount
+  if room >= 0 then
+    retry_after = math.ceil(window - elapsed - room * window / counter.pc)
+  else
+    retry_after = window - elapsed
+    if counter.cc > 0 then
+      retry_after = retry_after + math.max(math.ceil(window - (capacity - amount) * window / counter.cc), 0)
+    end
+  end
+end
+
+local reset_after = 0
+if counter.cc > 0 then
+  reset_after = 2 * window - elapsed
+elseif counter.pc > 0 then
+  reset_after = window - elapsed
+end
+
+return {allowed, math.max(math.floor(capacity - estimated), 0), 0, retry_after, reset_after}
+`
+
+// the Lua script that takes amount units out of the window they were
+// counted in, which is the window containing the timestamp age before now.
+const luaSlidingWindowCounterRefund = luaClock + `
+local key = KEYS[1]
+local window = tonumber(ARGV[1])
+local now = clock(tonumber(ARGV[2]))
+local amount = tonumber(ARGV[3])
+local ts = now - tonumber(ARGV[4])
+
+local value = redis.call("get", key)
+if not value then
+  return {0}
+end
+
+local start = now - now % window
+local counter = cjson.decode(value)
+counter.ws = tonumber(counter.ws)
+if counter.ws == start - window then
+  counter = {ws=start, pc=counter.cc, cc=0}
+elseif counter.ws ~= start then
+  return {0}
+end
+
+local counted = ts - ts % window
+if counted == start then
+  counter.cc = math.max(counter.cc - amount, 0)
+elseif counted == start - window then
+  counter.pc = math.max(counter.pc - amount, 0)
+else
+  return {0}
+end
+
+local ttl = math.ceil((start + 2 * window - now) / 1000)
+redis.call("set", key, cjson.encode({ws=string.format("%.f", start), pc=counter.pc, cc=counter.cc}), "px", ttl)
+return {1}
+`
+
+// loadSlidingWindowCounter loads the counter from tx, and slides it
+// to the window starting at start.
+func loadSlidingWindowCounter(tx Tx, key string, window, start int64) (pc, cc int64, ok bool, err error) {
+	value, ok, err := tx.Get(key)
+	if err != nil || !ok {
+		return 0, 0, ok, err
+	}
+	var ws int64
+	if err := decodeState(value, &ws, &pc, &cc); err != nil {
+		return 0, 0, false, err
+	}
+
+	switch ws {
+	case start:
+		return pc, cc, true, nil
+	case start - window:
+		return cc, 0, true, nil
+	default:
+		return 0, 0, false, nil
+	}
+}
+
+// slidingWindowCounter is the Go function equivalent to luaSlidingWindowCounter.
+func slidingWindowCounter(tx Tx, keys []string, args []int64) ([]int64, error) {
+	key := keys[0]
+	window, capacity, now, amount := args[0], args[1], args[2], args[3]
+
+	start := now - now%window
+	pc, cc, _, err := loadSlidingWindowCounter(tx, key, window, start)
+	if err != nil {
+		return nil, err
+	}
+
+	elapsed := now - start
+	estimated := float64(pc)*float64(window-elapsed)/float64(window) + float64(cc)
+
+	var allowed, retryAfter int64
+	if estimated+float64(amount) <= float64(capacity) {
+		cc = cc + amount
+		estimated = estimated + float64(amount)
+		ttl := time.Duration(ceilDiv(start+2*window-now, 1000)) * time.Millisecond
+		if err := tx.Set(key, encodeState(start, pc, cc), ttl); err != nil {
+			return nil, err
+		}
+		allowed = 1
+	} else {
+		room := capacity - cc - amount
+		if room >= 0 {
+			retryAfter = int64(math.Ceil(float64(window-elapsed) - float64(room)*float64(window)/float64(pc)))
+		} else {
+			retryAfter = window - elapsed
+			if cc > 0 {
+				retryAfter += maxInt64(int64(math.Ceil(float64(window)-float64(capacity-amount)*float64(window)/float64(cc))), 0)
+			}
+		}
+	}
+
+	var resetAfter int64
+	if cc > 0 {
+		resetAfter = 2*window - elapsed
+	} else if pc > 0 {
+		resetAfter = window - elapsed
+	}
+
+	remaining := maxInt64(int64(math.Floor(float64(capacity)-estimated)), 0)
+	return []int64{allowed, remaining, 0, retryAfter, resetAfter}, nil
+}
+
+// slidingWindowCounterRefund is the Go function equivalent to luaSlidingWindowCounterRefund.
+func slidingWindowCounterRefund(tx Tx, keys []string, args []int64) ([]int64, error) {
+	key := keys[0]
+	window, now, amount := args[0], args[1], args[2]
+	ts := now - args[3]
+
+	start := now - now%window
+	pc, cc, ok, err := loadSlidingWindowCounter(tx, key, window, start)
+	if err != nil || !ok {
+		return []int64{0}, err
+	}
+
+	switch ts - ts%window {
+	case start:
+		cc = maxInt64(cc-amount, 0)
+	case start - window:
+		pc = maxInt64(pc-amount, 0)
+	default:
+		return []int64{0}, nil
+	}
+
+	ttl := time.Duration(ceilDiv(start+2*window-now, 1000)) * time.Millisecond
+	if err := tx.Set(key, encodeState(start, pc, cc), ttl); err != nil {
+		return nil, err
+	}
+	return []int64{1}, nil
+}
+
+var (
+	slidingWindowCounterOp       = newOp("slidingwindowcounter", luaSlidingWindowCounter, 2, slidingWindowCounter)
+	slidingWindowCounterRefundOp = newOp("slidingwindowcounter.refund", luaSlidingWindowCounterRefund, 1, slidingWindowCounterRefund)
+)
+
+// SlidingWindowCounter implements the Sliding Window Counter Algorithm,
+// which approximates SlidingWindowLog by keeping only the counts of the
+// current and the previous windows, and by weighting the count of the
+// previous window by its overlap with the sliding window. Unlike a fixed
+// window, it does not allow bursts of twice the capacity at the window
+// boundaries, while the memory usage is constant per key.
+type SlidingWindowCounter struct {
+	baseBucket
+
+	store Store
+	key   string
+}
+
+// NewSlidingWindowCounter returns a new sliding-window-counter rate limiter
+// special for key in redis with the specified configuration.
+func NewSlidingWindowCounter(redis Redis, key string, config *Config) *SlidingWindowCounter {
+	return NewSlidingWindowCounterWithStore(NewRedisStore(redis), key, config)
+}
+
+// NewSlidingWindowCounterWithStore returns a new sliding-window-counter rate limiter
+// special for key in store with the specified configuration.
+func NewSlidingWindowCounterWithStore(store Store, key string, config *Config) *SlidingWindowCounter {
+	return &SlidingWindowCounter{
+		baseBucket: baseBucket{config: config},
+		store:      store,
+		key:        key,
+	}
+}
+
+// Allow implements Limiter by counting amount units in the current window.
+func (c *SlidingWindowCounter) Allow(ctx context.Context, amount int64) (Result, error) {
+	return c.prepare(amount).exec(ctx)
+}
+
+// prepare prepares the call for counting amount units in the current window.
+func (c *SlidingWindowCounter) prepare(amount int64) *call {
+	return c.prepareAt(amount, c.Clock().Now())
+}
+
+// prepareAt is like prepare, but counts the units at now.
+func (c *SlidingWindowCounter) prepareAt(amount int64, now time.Time) *call {
+	config := c.Config()
+	if amount > config.Capacity {
+		return resolvedCall(newUnsatisfiableResult(config.Capacity))
+	}
+
+	return &call{
+		store: c.store,
+		op:    slidingWindowCounterOp,
+		keys:  []string{c.key},
+		args: []int64{
+			int64(config.Interval / time.Microsecond),
+			config.Capacity,
+			int64(time.Duration(now.UnixNano()) / time.Microsecond),
+			amount,
+		},
+		limit: config.Capacity,
+		now:   now,
+	}
+}
+
+// Wait implements Limiter by blocking until amount units can be counted in the current window.
+func (c *SlidingWindowCounter) Wait(ctx context.Context, amount int64) error {
+	return wait(ctx, c, amount)
+}
+
+// Reserve implements Limiter by counting amount units in the current window,
+// which will be taken out of the window if the reservation is cancelled.
+func (c *SlidingWindowCounter) Reserve(ctx context.Context, amount int64) (*Reservation, error) {
+	reserved := c.Clock().Now()
+	r, err := c.prepareAt(amount, reserved).exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return newReservation(r, c.Clock(), func(ctx context.Context) error {
+		return c.refund(ctx, amount, reserved)
+	}), nil
+}
+
+// refund takes amount units out of the window they were counted in at reserved.
+//
+// Rather than reserved itself, the time elapsed since is passed, so that
+// the window is found by the same clock as the current one, even if the
+// store reads the time of the Redis server (see WithServerTime).
+func (c *SlidingWindowCounter) refund(ctx context.Context, amount int64, reserved time.Time) error {
+	config := c.Config()
+	now := c.Clock().Now()
+	_, err := c.store.Exec(
+		ctx,
+		slidingWindowCounterRefundOp,
+		[]string{c.key},
+		int64(config.Interval/time.Microsecond),
+		int64(time.Duration(now.UnixNano())/time.Microsecond),
+		amount,
+		int64(now.Sub(reserved)/time.Microsecond),
+	)
+	return err
+}
@@ -0,0 +1,26 @@
+package ratelimiter_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RussellLuo/ratelimiter"
+	"github.com/go-redis/redis"
+)
+
+func BenchmarkSlidingWindowCounter_Allow(b *testing.B) {
+	counter := ratelimiter.NewSlidingWindowCounter(
+		&Redis{redis.NewClient(&redis.Options{
+			Addr: "localhost:6379",
+		})},
+		"ratelimiter:slidingwindowcounter:benchmark",
+		&ratelimiter.Config{
+			Interval: 1 * time.Second / 2,
+			Capacity: 5,
+		},
+	)
+	for i := 0; i < b.N; i++ {
+		counter.Allow(context.Background(), 1)
+	}
+}
@@ -0,0 +1,151 @@
+package ratelimiter_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RussellLuo/ratelimiter"
+	"github.com/go-redis/redis"
+)
+
+func TestSlidingWindowCounter_Allow(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	key := "ratelimiter:slidingwindowcounter:test"
+	config := &ratelimiter.Config{
+		Interval: 1 * time.Second,
+		Capacity: 5,
+	}
+
+	// The fake clock starts at the beginning of a window.
+	clock := ratelimiter.NewFakeClock(time.Now().Truncate(config.Interval))
+
+	// moveTo moves the clock to the given offset into the next window.
+	moveTo := func(offset time.Duration) {
+		now := clock.Now()
+		clock.Set(now.Truncate(config.Interval).Add(config.Interval + offset))
+	}
+
+	stores := map[string]ratelimiter.Store{
+		"redis":  ratelimiter.NewRedisStore(&Redis{client}),
+		"memory": ratelimiter.NewMemory(ratelimiter.WithMemoryClock(clock)),
+	}
+	for name, store := range stores {
+		client.Del(key)
+		counter := ratelimiter.NewSlidingWindowCounterWithStore(store, key, config)
+		counter.SetClock(clock)
+
+		cases := []struct {
+			offset time.Duration
+			amount int64
+			want   ratelimiter.Result
+		}{
+			{
+				offset: 0,
+				amount: 3,
+				want: ratelimiter.Result{
+					Allowed:    true,
+					Limit:      5,
+					Remaining:  2,
+					ResetAfter: 2 * time.Second,
+				},
+			},
+			{
+				offset: -1,
+				amount: 3,
+				want: ratelimiter.Result{
+					Allowed:    false,
+					Limit:      5,
+					Remaining:  2,
+					RetryAfter: 1333334 * time.Microsecond,
+					ResetAfter: 2 * time.Second,
+				},
+			},
+			{
+				offset: -1,
+				amount: 2,
+				want: ratelimiter.Result{
+					Allowed:    true,
+					Limit:      5,
+					Remaining:  0,
+					ResetAfter: 2 * time.Second,
+				},
+			},
+			// Half of the previous window is still counted.
+			{
+				offset: 500 * time.Millisecond,
+				amount: 2,
+				want: ratelimiter.Result{
+					Allowed:    true,
+					Limit:      5,
+					Remaining:  0,
+					ResetAfter: 1500 * time.Millisecond,
+				},
+			},
+			{
+				offset: -1,
+				amount: 1,
+				want: ratelimiter.Result{
+					Allowed:    false,
+					Limit:      5,
+					Remaining:  0,
+					RetryAfter: 100 * time.Millisecond,
+					ResetAfter: 1500 * time.Millisecond,
+				},
+			},
+		}
+		for _, c := range cases {
+			if c.offset >= 0 {
+				moveTo(c.offset)
+			}
+			got, err := counter.Allow(context.Background(), c.amount)
+			if err != nil {
+				t.Fatalf("%s: Err: %v", name, err)
+			}
+			if !(got.Allowed == c.want.Allowed && got.Limit == c.want.Limit &&
+				got.Remaining == c.want.Remaining && got.RetryAfter == c.want.RetryAfter &&
+				got.ResetAfter == c.want.ResetAfter) {
+				t.Errorf("%s: Got (%#v) != Want (%#v)", name, got, c.want)
+			}
+		}
+	}
+}
+
+func TestSlidingWindowCounter_ServerTimeCancel(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	key := "ratelimiter:slidingwindowcounter:servertime:test"
+	client.Del(key)
+
+	counter := ratelimiter.NewSlidingWindowCounterWithStore(
+		ratelimiter.NewRedisStore(&Redis{client}, ratelimiter.WithServerTime()),
+		key,
+		&ratelimiter.Config{
+			Interval: time.Minute,
+			Capacity: 5,
+		},
+	)
+	// The clock of the client is far behind the one of the server.
+	counter.SetClock(ratelimiter.NewFakeClock(time.Now().Add(-time.Hour)))
+
+	ctx := context.Background()
+	r, err := counter.Reserve(ctx, 5)
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if err := r.Cancel(ctx); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+
+	// The units are taken out of the window of the server.
+	got, err := counter.Allow(ctx, 5)
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if !got.Allowed {
+		t.Errorf("Got (%#v) is not allowed", got)
+	}
+}
@@ -0,0 +1,283 @@
+package ratelimiter
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"sort"
+	"time"
+)
+
+// the Lua script that implements the Sliding Window Log Algorithm.
+// Each unit is logged as a member of a sorted set, whose score is the
+// timestamp of the time it was logged, and whose name is "{id}:{i}".
+const luaSlidingWindowLog = luaClock + `
+local key = KEYS[1]
+local window = tonumber(ARGV[1])
+local capacity = tonumber(ARGV[2])
+local now = clock(tonumber(ARGV[3]))
+local amount = tonumber(ARGV[4])
+local id = ARGV[5]
+
+redis.call("zremrangebyscore", key, "-inf", string.format("%.f", now - window))
+local count = redis.call("zcard", key)
+
+local allowed = 0
+local retry_after = 0
+if count + amount <= capacity then
+  for i = 1, amount do
+    redis.call("zadd", key, string.format("%.f", now), id .. ":" .. i)
+  end
+  redis.call("pexpire", key, math.ceil(window / 1000))
+  count = count + amount
+  allowed = 1
+else
+  local index = count + amount - capacity - 1
+  local oldest = redis.call("zrange", key, index, index, "withscores")
+  retry_after = tonumber(oldest[2]) + window - now
+end
+
+local reset_after = 0
+if count > 0 then
+  local newest = redis.call("zrange", key, -1, -1, "withscores")
+  reset_after = math.max(tonumber(newest[2]) + window - now, 0)
+end
+
+return {allowed, capacity - count, 0, retry_after, reset_after}
+`
+
+// the Lua script that removes the amount units logged with id.
+const luaSlidingWindowLogRefund = `
+local key = KEYS[1]
+local amount = tonumber(ARGV[3])
+local id = ARGV[4]
+
+for i = 1, amount do
+  redis.call("zrem", key, id .. ":" .. i)
+end
+return {1}
+`
+
+// slidingWindowLogEntry is the Go equivalent of a member in luaSlidingWindowLog.
+type slidingWindowLogEntry struct {
+	ts int64
+	id int64
+}
+
+func loadSlidingWindowLog(tx Tx, key string) ([]slidingWindowLogEntry, error) {
+	value, ok, err := tx.Get(key)
+	if err != nil || !ok {
+		return nil, err
+	}
+	fields, err := decodeFields(value)
+	if err != nil || len(fields)%2 != 0 {
+		return nil, errWrongType
+	}
+
+	entries := make([]slidingWindowLogEntry, len(fields)/2)
+	for i := range entries {
+		entries[i] = slidingWindowLogEntry{ts: fields[2*i], id: fields[2*i+1]}
+	}
+	return entries, nil
+}
+
+func saveSlidingWindowLog(tx Tx, key string, entries []slidingWindowLogEntry, ttl time.Duration) error {
+	if len(entries) == 0 {
+		return tx.Del(key)
+	}
+
+	fields := make([]int64, 0, 2*len(entries))
+	for _, e := range entries {
+		fields = append(fields, e.ts, e.id)
+	}
+	return tx.Set(key, encodeState(fields...), ttl)
+}
+
+// slidingWindowLog is the Go function equivalent to luaSlidingWindowLog.
+func slidingWindowLog(tx Tx, keys []string, args []int64) ([]int64, error) {
+	key := keys[0]
+	window, capacity, now, amount, id := args[0], args[1], args[2], args[3], args[4]
+
+	entries, err := loadSlidingWindowLog(tx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	// Remove the entries out of the window, keeping the rest sorted by timestamp.
+	live := entries[:0]
+	for _, e := range entries {
+		if e.ts > now-window {
+			live = append(live, e)
+		}
+	}
+	entries = live
+	count := int64(len(entries))
+
+	var allowed, retryAfter int64
+	if count+amount <= capacity {
+		for i := int64(0); i < amount; i++ {
+			entries = append(entries, slidingWindowLogEntry{ts: now, id: id})
+		}
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].ts < entries[j].ts
+		})
+		count = count + amount
+		allowed = 1
+	} else {
+		oldest := entries[count+amount-capacity-1]
+		retryAfter = oldest.ts + window - now
+	}
+
+	var resetAfter int64
+	if count > 0 {
+		resetAfter = maxInt64(entries[count-1].ts+window-now, 0)
+	}
+	ttl := time.Duration(ceilDiv(resetAfter, 1000)) * time.Millisecond
+	if err := saveSlidingWindowLog(tx, key, entries, ttl); err != nil {
+		return nil, err
+	}
+
+	return []int64{allowed, capacity - count, 0, retryAfter, resetAfter}, nil
+}
+
+// slidingWindowLogRefund is the Go function equivalent to luaSlidingWindowLogRefund.
+func slidingWindowLogRefund(tx Tx, keys []string, args []int64) ([]int64, error) {
+	key := keys[0]
+	window, now, amount, id := args[0], args[1], args[2], args[3]
+
+	entries, err := loadSlidingWindowLog(tx, key)
+	if err != nil || len(entries) == 0 {
+		return []int64{1}, err
+	}
+
+	kept := entries[:0]
+	for _, e := range entries {
+		if e.id == id && amount > 0 {
+			amount--
+			continue
+		}
+		kept = append(kept, e)
+	}
+
+	// Keep the log expiring when its newest entry slides out of the window.
+	var ttl time.Duration
+	if len(kept) > 0 {
+		ttl = time.Duration(ceilDiv(maxInt64(kept[len(kept)-1].ts+window-now, 1), 1000)) * time.Millisecond
+	}
+	if err := saveSlidingWindowLog(tx, key, kept, ttl); err != nil {
+		return nil, err
+	}
+	return []int64{1}, nil
+}
+
+var (
+	slidingWindowLogOp       = newOp("slidingwindowlog", luaSlidingWindowLog, 2, slidingWindowLog)
+	slidingWindowLogRefundOp = newOp("slidingwindowlog.refund", luaSlidingWindowLogRefund, 1, slidingWindowLogRefund)
+)
+
+// SlidingWindowLog implements the Sliding Window Log Algorithm, which
+// allows at most Capacity units in any window of length Interval.
+// Every unit allowed is logged until it slides out of the window,
+// which makes the algorithm exact at the cost of memory proportional
+// to the capacity.
+type SlidingWindowLog struct {
+	baseBucket
+
+	store Store
+	key   string
+}
+
+// NewSlidingWindowLog returns a new sliding-window-log rate limiter special
+// for key in redis with the specified configuration.
+func NewSlidingWindowLog(redis Redis, key string, config *Config) *SlidingWindowLog {
+	return NewSlidingWindowLogWithStore(NewRedisStore(redis), key, config)
+}
+
+// NewSlidingWindowLogWithStore returns a new sliding-window-log rate limiter special
+// for key in store with the specified configuration.
+func NewSlidingWindowLogWithStore(store Store, key string, config *Config) *SlidingWindowLog {
+	return &SlidingWindowLog{
+		baseBucket: baseBucket{config: config},
+		store:      store,
+		key:        key,
+	}
+}
+
+// Allow implements Limiter by logging amount units in the window.
+func (l *SlidingWindowLog) Allow(ctx context.Context, amount int64) (Result, error) {
+	return l.prepare(amount).exec(ctx)
+}
+
+// prepare prepares the call for logging amount units in the window.
+func (l *SlidingWindowLog) prepare(amount int64) *call {
+	return l.prepareID(amount, newID())
+}
+
+// prepareID is like prepare, but logs the units with id.
+func (l *SlidingWindowLog) prepareID(amount int64, id int64) *call {
+	config := l.Config()
+	if amount > config.Capacity {
+		return resolvedCall(newUnsatisfiableResult(config.Capacity))
+	}
+
+	now := l.Clock().Now()
+	return &call{
+		store: l.store,
+		op:    slidingWindowLogOp,
+		keys:  []string{l.key},
+		args: []int64{
+			int64(config.Interval / time.Microsecond),
+			config.Capacity,
+			int64(time.Duration(now.UnixNano()) / time.Microsecond),
+			amount,
+			id,
+		},
+		limit: config.Capacity,
+		now:   now,
+	}
+}
+
+// Wait implements Limiter by blocking until amount units can be logged in the window.
+func (l *SlidingWindowLog) Wait(ctx context.Context, amount int64) error {
+	return wait(ctx, l, amount)
+}
+
+// Reserve implements Limiter by logging amount units in the window,
+// which will be removed from the log if the reservation is cancelled.
+func (l *SlidingWindowLog) Reserve(ctx context.Context, amount int64) (*Reservation, error) {
+	id := newID()
+	r, err := l.prepareID(amount, id).exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return newReservation(r, l.Clock(), func(ctx context.Context) error {
+		return l.refund(ctx, amount, id)
+	}), nil
+}
+
+// refund removes the amount units logged with id.
+func (l *SlidingWindowLog) refund(ctx context.Context, amount int64, id int64) error {
+	config := l.Config()
+	now := l.Clock().Now().UnixNano()
+	_, err := l.store.Exec(
+		ctx,
+		slidingWindowLogRefundOp,
+		[]string{l.key},
+		int64(config.Interval/time.Microsecond),
+		int64(time.Duration(now)/time.Microsecond),
+		amount,
+		id,
+	)
+	return err
+}
+
+// newID returns a random non-negative ID, which is unique with
+// overwhelming probability.
+func newID() int64 {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		// Fall back to the current time, which is unique enough per process.
+		return time.Now().UnixNano()
+	}
+	return int64(binary.BigEndian.Uint64(b[:]) >> 1)
+}
@@ -0,0 +1,26 @@
+package ratelimiter_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RussellLuo/ratelimiter"
+	"github.com/go-redis/redis"
+)
+
+func BenchmarkSlidingWindowLog_Allow(b *testing.B) {
+	log := ratelimiter.NewSlidingWindowLog(
+		&Redis{redis.NewClient(&redis.Options{
+			Addr: "localhost:6379",
+		})},
+		"ratelimiter:slidingwindowlog:benchmark",
+		&ratelimiter.Config{
+			Interval: 1 * time.Second / 2,
+			Capacity: 5,
+		},
+	)
+	for i := 0; i < b.N; i++ {
+		log.Allow(context.Background(), 1)
+	}
+}
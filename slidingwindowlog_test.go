@@ -0,0 +1,149 @@
+package ratelimiter_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RussellLuo/ratelimiter"
+	"github.com/go-redis/redis"
+)
+
+func TestSlidingWindowLog_Allow(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	key := "ratelimiter:slidingwindowlog:test"
+
+	log := ratelimiter.NewSlidingWindowLog(
+		&Redis{client},
+		key,
+		&ratelimiter.Config{
+			Interval: 1 * time.Second,
+			Capacity: 5,
+		},
+	)
+	clock := ratelimiter.NewFakeClock(time.Now())
+	log.SetClock(clock)
+
+	f := func(amount int64) (bool, time.Duration, error) {
+		r, err := log.Allow(context.Background(), amount)
+		return r.Allowed, 0, err
+	}
+
+	cases := []struct {
+		in   []arg
+		want []result
+	}{
+		{
+			in: []arg{
+				{
+					WaitDuration: 0 * time.Second,
+					Concurrency:  4,
+					Amount:       1,
+				},
+				{
+					WaitDuration: 500 * time.Millisecond,
+					Concurrency:  4,
+					Amount:       1,
+				},
+				{
+					WaitDuration: 1100 * time.Millisecond,
+					Concurrency:  4,
+					Amount:       1,
+				},
+			},
+			want: []result{
+				{
+					Passed:  4,
+					Dropped: 0,
+				},
+				{
+					Passed:  1,
+					Dropped: 3,
+				},
+				{
+					Passed:  4,
+					Dropped: 0,
+				},
+			},
+		},
+		{
+			in: []arg{
+				{
+					WaitDuration: 0 * time.Second,
+					Concurrency:  1,
+					Amount:       5,
+				},
+				{
+					WaitDuration: 900 * time.Millisecond,
+					Concurrency:  2,
+					Amount:       1,
+				},
+				{
+					WaitDuration: 1100 * time.Millisecond,
+					Concurrency:  3,
+					Amount:       2,
+				},
+			},
+			want: []result{
+				{
+					Passed:  1,
+					Dropped: 0,
+				},
+				{
+					Passed:  0,
+					Dropped: 2,
+				},
+				{
+					Passed:  2,
+					Dropped: 1,
+				},
+			},
+		},
+	}
+	for _, c := range cases {
+		client.Del(key)
+		got := concurrentlyDo(clock, f, c.in)
+		if !deepEqual(got, c.want, false) {
+			t.Errorf("Got (%#v) != Want (%#v)", got, c.want)
+		}
+	}
+
+	client.Del(key)
+	cases2 := []struct {
+		amount int64
+		want   ratelimiter.Result
+	}{
+		{
+			amount: 3,
+			want: ratelimiter.Result{
+				Allowed:    true,
+				Limit:      5,
+				Remaining:  2,
+				ResetAfter: 1 * time.Second,
+			},
+		},
+		{
+			amount: 3,
+			want: ratelimiter.Result{
+				Allowed:    false,
+				Limit:      5,
+				Remaining:  2,
+				RetryAfter: 1 * time.Second,
+				ResetAfter: 1 * time.Second,
+			},
+		},
+	}
+	for _, c := range cases2 {
+		got, err := log.Allow(context.Background(), c.amount)
+		if err != nil {
+			t.Fatalf("Err: %v", err)
+		}
+		if !(got.Allowed == c.want.Allowed && got.Limit == c.want.Limit &&
+			got.Remaining == c.want.Remaining && got.RetryAfter == c.want.RetryAfter &&
+			got.ResetAfter == c.want.ResetAfter) {
+			t.Errorf("Got (%#v) != Want (%#v)", got, c.want)
+		}
+	}
+}
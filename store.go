@@ -0,0 +1,431 @@
+package ratelimiter
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store is the backend that the rate-limiting algorithms run against.
+//
+// RedisStore runs the Lua script of each operation, while any other store
+// (e.g. Memory) applies the Go function of the operation to a transaction
+// of its own. To add a new backend, implement Exec by beginning a
+// transaction, calling op.Apply with a Tx view of it, and committing the
+// transaction if no error occurs.
+type Store interface {
+	// Exec executes op atomically against keys with args, and returns
+	// the reply of op, which is always a list of integers.
+	Exec(ctx context.Context, op *Op, keys []string, args ...int64) ([]int64, error)
+}
+
+// Tx is the view of a Store that an Op is applied to. All the reads and
+// writes made through a Tx must be atomic as a whole, and be isolated from
+// any other concurrent transaction involving the same keys.
+type Tx interface {
+	// Get returns the value of key. The returned bool is false if key
+	// does not exist or has expired.
+	Get(key string) ([]byte, bool, error)
+
+	// Set sets the value of key, which never expires if ttl is zero.
+	Set(key string, value []byte, ttl time.Duration) error
+
+	// Del deletes key.
+	Del(key string) error
+}
+
+// OpFunc is the Go function of an Op.
+type OpFunc func(tx Tx, keys []string, args []int64) ([]int64, error)
+
+// Op is an atomic operation of a rate-limiting algorithm, which is
+// expressed both as a Lua script for Redis and as a Go function for any
+// other Store. Both forms must behave identically.
+type Op struct {
+	name   string
+	script string
+	hash   string
+	now    int
+	fn     OpFunc
+}
+
+// newOp returns a new operation, where now is the index of the argument
+// holding the current timestamp in microseconds, or -1 if the operation
+// takes no timestamp that can be replaced by the time of the Redis server.
+func newOp(name, script string, now int, fn OpFunc) *Op {
+	op := &Op{
+		name:   name,
+		script: script,
+		hash:   scriptHash(script),
+		now:    now,
+		fn:     fn,
+	}
+	registeredOps = append(registeredOps, op)
+	return op
+}
+
+// registeredOps is all the operations, whose scripts are loaded by
+// RedisStore.LoadScripts.
+var registeredOps []*Op
+
+// Name returns the name of the operation.
+func (o *Op) Name() string {
+	return o.name
+}
+
+// Script returns the Lua script of the operation.
+func (o *Op) Script() string {
+	return o.script
+}
+
+// Apply applies the Go function of the operation to tx.
+func (o *Op) Apply(tx Tx, keys []string, args []int64) ([]int64, error) {
+	return o.fn(tx, keys, args)
+}
+
+// the Lua function prepended to the scripts that take the current timestamp,
+// which returns the time of the Redis server instead if now is negative.
+const luaClock = `
+local function clock(now)
+  if now >= 0 then
+    return now
+  end
+  -- TIME is non-deterministic, which requires effects replication before Redis 5.
+  redis.replicate_commands()
+  local time = redis.call("time")
+  return tonumber(time[1]) * 1000000 + tonumber(time[2])
+end
+`
+
+// RedisStore is a Store backed by Redis, which runs the Lua script of
+// each operation.
+type RedisStore struct {
+	redis      Redis
+	serverTime bool
+	cluster    bool
+
+	// the batch scripts, keyed by the names of the operations they combine
+	batches sync.Map
+}
+
+// RedisStoreOption is an option for configuring RedisStore.
+type RedisStoreOption func(*RedisStore)
+
+// WithServerTime makes the scripts read the current time from the Redis
+// server by the TIME command, instead of using the time of each client,
+// so that all the clients share one authoritative clock regardless of
+// their clock skews. By default, the time of each client is used.
+//
+// Note that FixedWindow and Quota still select the window by the time of
+// the client, since each window is stored in a key of its own.
+func WithServerTime() RedisStoreOption {
+	return func(s *RedisStore) {
+		s.serverTime = true
+	}
+}
+
+// NewRedisStore returns a new store backed by redis.
+func NewRedisStore(redis Redis, opts ...RedisStoreOption) *RedisStore {
+	s := &RedisStore{redis: redis}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Exec implements Store by running the Lua script of op.
+func (s *RedisStore) Exec(ctx context.Context, op *Op, keys []string, args ...int64) ([]int64, error) {
+	if s.cluster {
+		if _, err := slotOf(keys); err != nil {
+			return nil, err
+		}
+	}
+
+	script := &Script{redis: s.redis, src: op.script, hash: op.hash}
+
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg
+	}
+	if s.serverTime && op.now >= 0 && op.now < len(values) {
+		// A negative timestamp makes the script read the server time instead.
+		values[op.now] = -1
+	}
+
+	reply, err := s.run(ctx, script, keys, values)
+	if err != nil {
+		return nil, err
+	}
+	return parseReply(reply)
+}
+
+// the Lua script that runs a batch of operations, each of which is defined
+// as a function taking its own KEYS and ARGV. ARGV[1] is the number of
+// operations, followed by the index, the number of keys and the number of
+// args of each operation, along with its args.
+const luaBatch = `
+local replies = {}
+local k, a = 1, 2
+for i = 1, tonumber(ARGV[1]) do
+  local op, nkeys, nargs = tonumber(ARGV[a]), tonumber(ARGV[a + 1]), tonumber(ARGV[a + 2])
+  a = a + 3
+  local keys, args = {}, {}
+  for j = 1, nkeys do
+    keys[j] = KEYS[k]
+    k = k + 1
+  end
+  for j = 1, nargs do
+    args[j] = ARGV[a]
+    a = a + 1
+  end
+  replies[i] = ops[op](keys, args)
+end
+`
+
+// the Lua script that saves the values and the TTLs of all the keys before
+// running an all-or-nothing batch, which only supports string values.
+const luaBatchSave = `
+local saved = {}
+for _, key in ipairs(KEYS) do
+  if not saved[key] then
+    saved[key] = {redis.call("get", key), redis.call("pttl", key)}
+  end
+end
+`
+
+// the Lua script that restores all the keys unless every operation of
+// an all-or-nothing batch is allowed.
+const luaBatchRestore = `
+local admitted = true
+for _, reply in ipairs(replies) do
+  if reply[1] ~= 1 then
+    admitted = false
+  end
+end
+if not admitted then
+  for key, s in pairs(saved) do
+    if not s[1] then
+      redis.call("del", key)
+    elseif s[2] > 0 then
+      redis.call("set", key, s[1], "px", s[2])
+    else
+      redis.call("set", key, s[1])
+    end
+  end
+end
+`
+
+// ExecBatch implements BatchStore by running the Lua scripts of ops in
+// one script, which takes one round trip.
+func (s *RedisStore) ExecBatch(ctx context.Context, ops []BatchOp) ([][]int64, error) {
+	return s.execBatch(ctx, ops, false)
+}
+
+// ExecAllOrNothing implements AllOrNothingStore by running the Lua scripts
+// of ops in one script, which restores the keys before returning unless
+// every operation is allowed.
+func (s *RedisStore) ExecAllOrNothing(ctx context.Context, ops []BatchOp) ([][]int64, error) {
+	return s.execBatch(ctx, ops, true)
+}
+
+func (s *RedisStore) execBatch(ctx context.Context, ops []BatchOp, allOrNothing bool) ([][]int64, error) {
+	if s.cluster {
+		var keys []string
+		for _, o := range ops {
+			keys = append(keys, o.Keys...)
+		}
+		if _, err := slotOf(keys); err != nil {
+			if allOrNothing {
+				return nil, err
+			}
+			return s.execSlots(ctx, ops)
+		}
+	}
+
+	// The distinct operations of the batch, in order of appearance.
+	var distinct []*Op
+	indexes := make(map[*Op]int)
+	for _, o := range ops {
+		if _, ok := indexes[o.Op]; !ok {
+			distinct = append(distinct, o.Op)
+			indexes[o.Op] = len(distinct)
+		}
+	}
+	script := s.batchScript(distinct, allOrNothing)
+
+	var keys []string
+	values := []interface{}{len(ops)}
+	for _, o := range ops {
+		keys = append(keys, o.Keys...)
+		values = append(values, indexes[o.Op], len(o.Keys), len(o.Args))
+		for i, arg := range o.Args {
+			if s.serverTime && i == o.Op.now {
+				// A negative timestamp makes the script read the server time instead.
+				arg = -1
+			}
+			values = append(values, arg)
+		}
+	}
+
+	reply, err := s.run(ctx, script, keys, values)
+	if err != nil {
+		return nil, err
+	}
+	list, ok := reply.([]interface{})
+	if !ok || len(list) != len(ops) {
+		return nil, fmt.Errorf("ratelimiter: unexpected reply %v", reply)
+	}
+	replies := make([][]int64, len(list))
+	for i, r := range list {
+		if replies[i], err = parseReply(r); err != nil {
+			return nil, err
+		}
+	}
+	return replies, nil
+}
+
+// batchScript returns the script running a batch of ops, which is built
+// once for each combination of operations.
+func (s *RedisStore) batchScript(ops []*Op, allOrNothing bool) *Script {
+	names := make([]string, len(ops))
+	for i, op := range ops {
+		names[i] = op.name
+	}
+	id := strings.Join(names, ",")
+	if allOrNothing {
+		id = "all:" + id
+	}
+	if script, ok := s.batches.Load(id); ok {
+		return script.(*Script)
+	}
+
+	var b strings.Builder
+	if s.serverTime {
+		// Enable effects replication before any write, which is required
+		// by TIME in every operation but the first one before Redis 5.
+		b.WriteString("redis.replicate_commands()\n")
+	}
+	b.WriteString("local ops = {}\n")
+	for i, op := range ops {
+		fmt.Fprintf(&b, "ops[%d] = function(KEYS, ARGV)\n%s\nend\n", i+1, op.script)
+	}
+	if allOrNothing {
+		b.WriteString(luaBatchSave)
+	}
+	b.WriteString(luaBatch)
+	if allOrNothing {
+		b.WriteString(luaBatchRestore)
+	}
+	b.WriteString("return replies\n")
+
+	script, loaded := s.batches.LoadOrStore(id, NewScript(s.redis, b.String()))
+	if loader, ok := s.redis.(ScriptLoader); ok && s.cluster && !loaded {
+		// Load the new script on every node at once, instead of on the first
+		// batch on each node. A failure is left to the fallback to EVAL.
+		loader.ScriptLoad(b.String())
+	}
+	return script.(*Script)
+}
+
+// parseReply converts the reply of a Lua script into a list of integers.
+func parseReply(reply interface{}) ([]int64, error) {
+	values, ok := reply.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("ratelimiter: unexpected reply %v", reply)
+	}
+
+	ints := make([]int64, len(values))
+	for i, v := range values {
+		n, ok := v.(int64)
+		if !ok {
+			return nil, fmt.Errorf("ratelimiter: unexpected reply %v", reply)
+		}
+		ints[i] = n
+	}
+	return ints, nil
+}
+
+var errWrongType = errors.New("ratelimiter: key holding the wrong kind of value")
+
+// encodeState encodes the integer fields of a state, which is used by the
+// Go function of an operation to store the state in a Tx.
+func encodeState(fields ...int64) []byte {
+	buf := make([]byte, len(fields)*binary.MaxVarintLen64)
+	n := 0
+	for _, f := range fields {
+		n += binary.PutVarint(buf[n:], f)
+	}
+	return buf[:n]
+}
+
+// decodeFields decodes all the integer fields of a state encoded by encodeState.
+func decodeFields(data []byte) ([]int64, error) {
+	var fields []int64
+	for len(data) > 0 {
+		v, n := binary.Varint(data)
+		if n <= 0 {
+			return nil, errWrongType
+		}
+		fields, data = append(fields, v), data[n:]
+	}
+	return fields, nil
+}
+
+// decodeState decodes the integer fields of a state encoded by encodeState.
+func decodeState(data []byte, fields ...*int64) error {
+	for _, f := range fields {
+		v, n := binary.Varint(data)
+		if n <= 0 {
+			return errWrongType
+		}
+		*f, data = v, data[n:]
+	}
+	if len(data) != 0 {
+		return errWrongType
+	}
+	return nil
+}
+
+// setOrDel sets the value of key, which expires after the duration d in
+// microseconds rounded up to milliseconds, like SET with PX in the Lua
+// scripts. It deletes key instead if d is not positive.
+func setOrDel(tx Tx, key string, value []byte, d int64) error {
+	ttl := time.Duration(ceilDiv(d, 1000)) * time.Millisecond
+	if ttl <= 0 {
+		return tx.Del(key)
+	}
+	return tx.Set(key, value, ttl)
+}
+
+// floorDiv returns the largest integer less than or equal to x/y,
+// which behaves like math.floor(x / y) in Lua.
+func floorDiv(x, y int64) int64 {
+	q := x / y
+	if (x%y != 0) && ((x < 0) != (y < 0)) {
+		q--
+	}
+	return q
+}
+
+// ceilDiv returns the smallest integer greater than or equal to x/y,
+// which behaves like math.ceil(x / y) in Lua.
+func ceilDiv(x, y int64) int64 {
+	return -floorDiv(-x, y)
+}
+
+func minInt64(x, y int64) int64 {
+	if x < y {
+		return x
+	}
+	return y
+}
+
+func maxInt64(x, y int64) int64 {
+	if x > y {
+		return x
+	}
+	return y
+}
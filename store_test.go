@@ -0,0 +1,142 @@
+package ratelimiter_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RussellLuo/ratelimiter"
+	"github.com/go-redis/redis"
+)
+
+// mapStore is a minimal custom Store, which guards a map with a single lock.
+// A real backend would begin and commit a transaction of its own instead.
+type mapStore struct {
+	mu    sync.Mutex
+	items map[string][]byte
+}
+
+func (s *mapStore) Exec(ctx context.Context, op *ratelimiter.Op, keys []string, args ...int64) ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return op.Apply(mapTx{s.items}, keys, args)
+}
+
+// mapTx implements ratelimiter.Tx, ignoring expiration for brevity.
+type mapTx struct {
+	items map[string][]byte
+}
+
+func (tx mapTx) Get(key string) ([]byte, bool, error) {
+	value, ok := tx.items[key]
+	return value, ok, nil
+}
+
+func (tx mapTx) Set(key string, value []byte, ttl time.Duration) error {
+	tx.items[key] = value
+	return nil
+}
+
+func (tx mapTx) Del(key string) error {
+	delete(tx.items, key)
+	return nil
+}
+
+func ExampleStore() {
+	store := &mapStore{items: make(map[string][]byte)}
+	tb := ratelimiter.NewTokenBucketWithStore(
+		store,
+		"ratelimiter:tokenbucket:example",
+		&ratelimiter.Config{
+			Interval: 1 * time.Second / 2,
+			Capacity: 5,
+		},
+	)
+	for i := 0; i < 6; i++ {
+		if ok, _ := tb.Take(1); ok {
+			fmt.Println("PASS")
+		} else {
+			fmt.Println("DROP")
+		}
+	}
+	// Output:
+	// PASS
+	// PASS
+	// PASS
+	// PASS
+	// PASS
+	// DROP
+}
+
+func TestRedisStore_ServerTime(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	key := "ratelimiter:servertime:test"
+	store := ratelimiter.NewRedisStore(&Redis{client}, ratelimiter.WithServerTime())
+	config := &ratelimiter.Config{
+		Interval: 1 * time.Second / 2,
+		Capacity: 5,
+	}
+
+	cases := []struct {
+		name    string
+		limiter ratelimiter.Limiter
+		want    []ratelimiter.Result
+	}{
+		{
+			name:    "tokenbucket",
+			limiter: ratelimiter.NewTokenBucketWithStore(store, key, config),
+			want: []ratelimiter.Result{
+				{Allowed: true, Limit: 5, Remaining: 2, ResetAfter: 1500 * time.Millisecond},
+				{Allowed: false, Limit: 5, Remaining: 2, RetryAfter: 500 * time.Millisecond, ResetAfter: 1500 * time.Millisecond},
+				{Allowed: true, Limit: 5, Remaining: 0, ResetAfter: 2500 * time.Millisecond},
+			},
+		},
+		{
+			name:    "gcra",
+			limiter: ratelimiter.NewGCRAWithStore(store, key, config),
+			want: []ratelimiter.Result{
+				{Allowed: true, Limit: 5, Remaining: 2, ResetAfter: 1500 * time.Millisecond},
+				{Allowed: false, Limit: 5, Remaining: 2, RetryAfter: 500 * time.Millisecond, ResetAfter: 1500 * time.Millisecond},
+				{Allowed: true, Limit: 5, Remaining: 0, Delay: 1500 * time.Millisecond, ResetAfter: 2500 * time.Millisecond},
+			},
+		},
+		{
+			name:    "slidingwindowlog",
+			limiter: ratelimiter.NewSlidingWindowLogWithStore(store, key, config),
+			want: []ratelimiter.Result{
+				{Allowed: true, Limit: 5, Remaining: 2, ResetAfter: 500 * time.Millisecond},
+				{Allowed: false, Limit: 5, Remaining: 2, RetryAfter: 500 * time.Millisecond, ResetAfter: 500 * time.Millisecond},
+				{Allowed: true, Limit: 5, Remaining: 0, ResetAfter: 500 * time.Millisecond},
+			},
+		},
+	}
+	for _, c := range cases {
+		client.Del(key)
+		start := time.Now()
+		for i, amount := range []int64{3, 3, 2} {
+			got, err := c.limiter.Allow(context.Background(), amount)
+			if err != nil {
+				t.Fatalf("%s: Err: %v", c.name, err)
+			}
+
+			// The clock of the server runs in real time, so the durations
+			// are shorter by at most the time elapsed since the first call,
+			// which is in microseconds on the server.
+			elapsed := time.Since(start).Truncate(time.Microsecond) + time.Microsecond
+			shorter := func(got, want time.Duration) bool {
+				return got <= want && got >= want-elapsed
+			}
+
+			want := c.want[i]
+			if !(got.Allowed == want.Allowed && got.Limit == want.Limit &&
+				got.Remaining == want.Remaining && shorter(got.Delay, want.Delay) &&
+				shorter(got.RetryAfter, want.RetryAfter) && shorter(got.ResetAfter, want.ResetAfter)) {
+				t.Errorf("%s: Got (%#v) != Want (%#v)", c.name, got, want)
+			}
+		}
+	}
+}
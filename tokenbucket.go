@@ -1,23 +1,26 @@
 package ratelimiter
 
 import (
+	"context"
 	"time"
 )
 
 // the Lua script that implements the Token Bucket Algorithm.
 // bucket.tc represents the token count.
 // bucket.ts represents the timestamp of the last time the bucket was refilled.
-const luaTokenBucket = `
+// The bucket expires once it is full, which is identical to a new bucket.
+const luaTokenBucket = luaClock + `
 local key = KEYS[1]
 local interval = tonumber(ARGV[1])
 local capacity = tonumber(ARGV[2])
-local now = tonumber(ARGV[3])
+local now = clock(tonumber(ARGV[3]))
 local amount = tonumber(ARGV[4])
 
 local bucket = {tc=capacity, ts=now}
 local value = redis.call("get", key)
 if value then
   bucket = cjson.decode(value)
+  bucket.ts = tonumber(bucket.ts)
 end
 
 local added = math.floor((now - bucket.ts) / interval)
@@ -26,54 +29,213 @@ if added > 0 then
   bucket.ts = bucket.ts + added * interval
 end
 
+local allowed = 0
+local retry_after = 0
 if bucket.tc >= amount then
   bucket.tc = bucket.tc - amount
-  bucket.ts = string.format("%.f", bucket.ts)
-  if redis.call("set", key, cjson.encode(bucket)) then
-    return 1
+  local ttl = math.ceil(((capacity - bucket.tc) * interval - (now - bucket.ts)) / 1000)
+  if ttl > 0 then
+    redis.call("set", key, cjson.encode({tc=bucket.tc, ts=string.format("%.f", bucket.ts)}), "px", string.format("%.f", ttl))
+  else
+    redis.call("del", key)
   end
+  allowed = 1
+else
+  retry_after = (amount - bucket.tc) * interval - (now - bucket.ts)
 end
 
-return 0
+local reset_after = math.max((capacity - bucket.tc) * interval - (now - bucket.ts), 0)
+return {allowed, bucket.tc, 0, retry_after, reset_after}
 `
 
+// the Lua script that returns amount tokens back to the bucket,
+// without exceeding the capacity.
+const luaTokenBucketRefund = luaClock + `
+local key = KEYS[1]
+local interval = tonumber(ARGV[1])
+local capacity = tonumber(ARGV[2])
+local now = clock(tonumber(ARGV[3]))
+local amount = tonumber(ARGV[4])
+
+local value = redis.call("get", key)
+if not value then
+  return {0}
+end
+
+local bucket = cjson.decode(value)
+bucket.ts = tonumber(bucket.ts)
+
+local added = math.floor((now - bucket.ts) / interval)
+if added > 0 then
+  bucket.ts = bucket.ts + added * interval
+end
+
+bucket.tc = math.min(bucket.tc + math.max(added, 0) + amount, capacity)
+local ttl = math.ceil(((capacity - bucket.tc) * interval - (now - bucket.ts)) / 1000)
+if ttl > 0 then
+  redis.call("set", key, cjson.encode({tc=bucket.tc, ts=string.format("%.f", bucket.ts)}), "px", string.format("%.f", ttl))
+else
+  redis.call("del", key)
+end
+return {1}
+`
+
+// tokenBucket is the Go function equivalent to luaTokenBucket.
+func tokenBucket(tx Tx, keys []string, args []int64) ([]int64, error) {
+	key := keys[0]
+	interval, capacity, now, amount := args[0], args[1], args[2], args[3]
+
+	tc, ts := capacity, now
+	value, ok, err := tx.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		if err := decodeState(value, &tc, &ts); err != nil {
+			return nil, err
+		}
+	}
+
+	added := floorDiv(now-ts, interval)
+	if added > 0 {
+		tc = minInt64(tc+added, capacity)
+		ts = ts + added*interval
+	}
+
+	var allowed, retryAfter int64
+	if tc >= amount {
+		tc = tc - amount
+		if err := setOrDel(tx, key, encodeState(tc, ts), (capacity-tc)*interval-(now-ts)); err != nil {
+			return nil, err
+		}
+		allowed = 1
+	} else {
+		retryAfter = (amount-tc)*interval - (now - ts)
+	}
+
+	resetAfter := maxInt64((capacity-tc)*interval-(now-ts), 0)
+	return []int64{allowed, tc, 0, retryAfter, resetAfter}, nil
+}
+
+// tokenBucketRefund is the Go function equivalent to luaTokenBucketRefund.
+func tokenBucketRefund(tx Tx, keys []string, args []int64) ([]int64, error) {
+	key := keys[0]
+	interval, capacity, now, amount := args[0], args[1], args[2], args[3]
+
+	value, ok, err := tx.Get(key)
+	if err != nil || !ok {
+		return []int64{0}, err
+	}
+	var tc, ts int64
+	if err := decodeState(value, &tc, &ts); err != nil {
+		return nil, err
+	}
+
+	added := floorDiv(now-ts, interval)
+	if added > 0 {
+		ts = ts + added*interval
+	}
+
+	tc = minInt64(tc+maxInt64(added, 0)+amount, capacity)
+	if err := setOrDel(tx, key, encodeState(tc, ts), (capacity-tc)*interval-(now-ts)); err != nil {
+		return nil, err
+	}
+	return []int64{1}, nil
+}
+
+var (
+	tokenBucketOp       = newOp("tokenbucket", luaTokenBucket, 2, tokenBucket)
+	tokenBucketRefundOp = newOp("tokenbucket.refund", luaTokenBucketRefund, 2, tokenBucketRefund)
+)
+
 // TokenBucket implements the Token Bucket Algorithm.
 // See https://en.wikipedia.org/wiki/Token_bucket.
 type TokenBucket struct {
 	baseBucket
 
-	script *Script
-	key    string
+	store Store
+	key   string
 }
 
 // NewTokenBucket returns a new token-bucket rate limiter special for key in redis
 // with the specified bucket configuration.
 func NewTokenBucket(redis Redis, key string, config *Config) *TokenBucket {
+	return NewTokenBucketWithStore(NewRedisStore(redis), key, config)
+}
+
+// NewTokenBucketWithStore returns a new token-bucket rate limiter special for key in store
+// with the specified bucket configuration.
+func NewTokenBucketWithStore(store Store, key string, config *Config) *TokenBucket {
 	return &TokenBucket{
 		baseBucket: baseBucket{config: config},
-		script:     NewScript(redis, luaTokenBucket),
+		store:      store,
 		key:        key,
 	}
 }
 
 // Take takes amount tokens from the bucket.
 func (b *TokenBucket) Take(amount int64) (bool, error) {
+	r, err := b.Allow(context.Background(), amount)
+	return r.Allowed, err
+}
+
+// Allow implements Limiter by taking amount tokens from the bucket.
+func (b *TokenBucket) Allow(ctx context.Context, amount int64) (Result, error) {
+	return b.prepare(amount).exec(ctx)
+}
+
+// prepare prepares the call for taking amount tokens from the bucket.
+func (b *TokenBucket) prepare(amount int64) *call {
 	config := b.Config()
 	if amount > config.Capacity {
-		return false, nil
+		return resolvedCall(newUnsatisfiableResult(config.Capacity))
+	}
+
+	now := b.Clock().Now()
+	return &call{
+		store: b.store,
+		op:    tokenBucketOp,
+		keys:  []string{b.key},
+		args: []int64{
+			int64(config.Interval / time.Microsecond),
+			config.Capacity,
+			int64(time.Duration(now.UnixNano()) / time.Microsecond),
+			amount,
+		},
+		limit: config.Capacity,
+		now:   now,
 	}
+}
+
+// Wait implements Limiter by blocking until amount tokens can be taken from the bucket.
+func (b *TokenBucket) Wait(ctx context.Context, amount int64) error {
+	return wait(ctx, b, amount)
+}
 
-	now := time.Now().UnixNano()
-	result, err := b.script.Run(
+// Reserve implements Limiter by taking amount tokens from the bucket,
+// which will be returned back if the reservation is cancelled.
+func (b *TokenBucket) Reserve(ctx context.Context, amount int64) (*Reservation, error) {
+	r, err := b.Allow(ctx, amount)
+	if err != nil {
+		return nil, err
+	}
+	return newReservation(r, b.Clock(), func(ctx context.Context) error {
+		return b.refund(ctx, amount)
+	}), nil
+}
+
+// refund returns amount tokens back to the bucket.
+func (b *TokenBucket) refund(ctx context.Context, amount int64) error {
+	config := b.Config()
+	now := b.Clock().Now().UnixNano()
+	_, err := b.store.Exec(
+		ctx,
+		tokenBucketRefundOp,
 		[]string{b.key},
 		int64(config.Interval/time.Microsecond),
 		config.Capacity,
 		int64(time.Duration(now)/time.Microsecond),
 		amount,
 	)
-	if err != nil {
-		return false, err
-	} else {
-		return result == int64(1), nil
-	}
+	return err
 }
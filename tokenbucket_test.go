@@ -1,6 +1,7 @@
 package ratelimiter_test
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -22,6 +23,8 @@ func TestTokenBucket_Take(t *testing.T) {
 			Capacity: 5,
 		},
 	)
+	clock := ratelimiter.NewFakeClock(time.Now())
+	bucket.SetClock(clock)
 
 	f := func(amount int64) (bool, time.Duration, error) {
 		ok, err := bucket.Take(amount)
@@ -134,9 +137,120 @@ func TestTokenBucket_Take(t *testing.T) {
 	}
 	for _, c := range cases {
 		client.Del(key)
-		got := concurrentlyDo(f, c.in)
+		got := concurrentlyDo(clock, f, c.in)
 		if !deepEqual(got, c.want, false) {
 			t.Errorf("Got (%#v) != Want (%#v)", got, c.want)
 		}
 	}
 }
+
+func TestTokenBucket_Allow(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	key := "ratelimiter:tokenbucket:test"
+
+	bucket := ratelimiter.NewTokenBucket(
+		&Redis{client},
+		key,
+		&ratelimiter.Config{
+			Interval: 1 * time.Second / 2,
+			Capacity: 5,
+		},
+	)
+	clock := ratelimiter.NewFakeClock(time.Now())
+	bucket.SetClock(clock)
+
+	client.Del(key)
+	cases := []struct {
+		amount int64
+		want   ratelimiter.Result
+	}{
+		{
+			amount: 3,
+			want: ratelimiter.Result{
+				Allowed:    true,
+				Limit:      5,
+				Remaining:  2,
+				ResetAfter: 1500 * time.Millisecond,
+			},
+		},
+		{
+			amount: 3,
+			want: ratelimiter.Result{
+				Allowed:    false,
+				Limit:      5,
+				Remaining:  2,
+				RetryAfter: 500 * time.Millisecond,
+				ResetAfter: 1500 * time.Millisecond,
+			},
+		},
+		{
+			amount: 2,
+			want: ratelimiter.Result{
+				Allowed:    true,
+				Limit:      5,
+				Remaining:  0,
+				ResetAfter: 2500 * time.Millisecond,
+			},
+		},
+		{
+			amount: 6,
+			want: ratelimiter.Result{
+				Allowed:    false,
+				Limit:      5,
+				Remaining:  0,
+				RetryAfter: -1,
+			},
+		},
+	}
+	for _, c := range cases {
+		got, err := bucket.Allow(context.Background(), c.amount)
+		if err != nil {
+			t.Fatalf("Err: %v", err)
+		}
+		if !(got.Allowed == c.want.Allowed && got.Limit == c.want.Limit &&
+			got.Remaining == c.want.Remaining && got.Delay == c.want.Delay &&
+			got.RetryAfter == c.want.RetryAfter && got.ResetAfter == c.want.ResetAfter) {
+			t.Errorf("Got (%#v) != Want (%#v)", got, c.want)
+		}
+	}
+}
+
+func TestTokenBucket_Expiry(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "localhost:6379",
+	})
+	key := "ratelimiter:tokenbucket:test"
+
+	bucket := ratelimiter.NewTokenBucket(
+		&Redis{client},
+		key,
+		&ratelimiter.Config{
+			Interval: 1 * time.Second / 2,
+			Capacity: 5,
+		},
+	)
+
+	client.Del(key)
+	start := time.Now()
+	r, err := bucket.Reserve(context.Background(), 3)
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+
+	// The bucket expires once it returns to its initial state. The TTL
+	// counts down in real time, and is truncated to milliseconds.
+	got, want := client.PTTL(key).Val(), r.Result().ResetAfter
+	if elapsed := time.Since(start) + time.Millisecond; !(got <= want && got >= want-elapsed) {
+		t.Errorf("Got TTL (%v) != Want (%v)", got, want)
+	}
+
+	// Returning all the units back brings the bucket to its initial state at once.
+	if err := r.Cancel(context.Background()); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if n := client.Exists(key).Val(); n != 0 {
+		t.Errorf("Got key existing after cancellation")
+	}
+}